@@ -9,28 +9,6 @@ import (
 	"strings"
 )
 
-// Transpose a grid from row by column to column by row
-func transposeGrid(grid [][][4]uint8) [][][4]uint8 {
-	newGrid := [][][4]uint8{}
-
-	// initialize new grid
-	for range grid[0] {
-		newColumn := [][4]uint8{}
-		for range grid {
-			newColumn = append(newColumn, [4]uint8{})
-		}
-		newGrid = append(newGrid, newColumn)
-	}
-
-	// populate new grid
-	for rowY, row := range grid {
-		for colX, cell := range row {
-			newGrid[colX][rowY] = cell
-		}
-	}
-	return newGrid
-}
-
 func assignColorsToGrid(image []string, colors map[string][4]uint8) [][][4]uint8 {
 	grid := [][][4]uint8{}
 
@@ -42,7 +20,9 @@ func assignColorsToGrid(image []string, colors map[string][4]uint8) [][][4]uint8
 		grid = append(grid, newRow)
 	}
 
-	return transposeGrid(grid)
+	// The rows all have the same length, so there won't be an error
+	columnGrid, _ := pixels2svg.GetColorGridFromRows(grid)
+	return columnGrid
 }
 
 func sailboat() [][][4]uint8 {
@@ -74,11 +54,6 @@ func sailboat() [][][4]uint8 {
 	return assignColorsToGrid(image, colors)
 }
 
-// See https://jimdoescode.github.io/2015/05/22/manipulating-colors-in-go.html
-func convertToUint8(rgbTone uint32) uint8 {
-	return uint8(rgbTone / 0x101)
-}
-
 func ReadPNGPixels(filePath string) ([][][4]uint8, error) {
 
 	var infile *os.File
@@ -98,24 +73,7 @@ func ReadPNGPixels(filePath string) ([][][4]uint8, error) {
 		return nil, err
 	}
 
-	colorGrid := [][][4]uint8{}
-	bounds := src.Bounds()
-	width, height := bounds.Max.X, bounds.Max.Y
-	for x := 0; x < width; x++ {
-		newCol := [][4]uint8{}
-		for y := 0; y < height; y++ {
-			red, green, blue, _ := src.At(x, y).RGBA()
-			red8 := convertToUint8(red)
-			green8 := convertToUint8(green)
-			blue8 := convertToUint8(blue)
-
-			colorRGBA := [4]uint8{red8, green8, blue8, 255}
-			newCol = append(newCol, colorRGBA)
-		}
-		colorGrid = append(colorGrid, newCol)
-	}
-
-	return colorGrid, nil
+	return pixels2svg.GetColorGridFromImage(src), nil
 }
 
 func addError(errors *[]string, summary string, err error) {
@@ -125,6 +83,14 @@ func addError(errors *[]string, summary string, err error) {
 	)
 }
 
+func writeSVGToFile(s *pixels2svg.ShapeExtractor, filePath string, errors *[]string) {
+	if err := s.WriteSVGToFile(filePath); err != nil {
+		addError(errors, strings.Join([]string{" Error: ", filePath, "  ... "}, ""), err)
+		return
+	}
+	println("\nWrote SVG to ", filePath)
+}
+
 /*
  * In order to see the SVG as an image,
  *   open the *.html files in a browser
@@ -140,11 +106,14 @@ func main() {
 	var err error
 
 	s.Init(sailboat())
-	s.WriteSVGToFile("example_sailboat.html")
+	writeSVGToFile(&s, "example_sailboat.html", &errors)
+
+	// Leave out the transparent pixels of the png files
+	s.UseAlpha = true
 
 	if colorGrid, err = ReadPNGPixels("test1.png"); err == nil {
 		s.Init(colorGrid)
-		s.WriteSVGToFile("example_test1.html")
+		writeSVGToFile(&s, "example_test1.html", &errors)
 	}
 
 	args := os.Args[1:]
@@ -161,7 +130,7 @@ func main() {
 			}
 			s.Init(colorGrid)
 			newName := strings.TrimSuffix(nextInput, ".png") + ".html"
-			s.WriteSVGToFile(newName)
+			writeSVGToFile(&s, newName, &errors)
 		}
 	}
 
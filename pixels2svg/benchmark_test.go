@@ -0,0 +1,183 @@
+package pixels2svg
+
+import (
+	"math/rand"
+	"testing"
+)
+
+/*
+ *  A grid with every cell the same color
+ */
+func getUniformColorGrid(colCount, rowCount int) [][][4]uint8 {
+	colorGrid := make([][][4]uint8, colCount)
+	for colX := range colorGrid {
+		nextCol := make([][4]uint8, rowCount)
+		for rowY := range nextCol {
+			nextCol[rowY] = [4]uint8{10, 20, 30, 255}
+		}
+		colorGrid[colX] = nextCol
+	}
+	return colorGrid
+}
+
+/*
+ *  A grid with each cell randomly one of a few colors
+ */
+func getNoisyColorGrid(colCount, rowCount, colorCount int) [][][4]uint8 {
+	random := rand.New(rand.NewSource(42))
+	colorGrid := make([][][4]uint8, colCount)
+	for colX := range colorGrid {
+		nextCol := make([][4]uint8, rowCount)
+		for rowY := range nextCol {
+			shade := uint8(random.Intn(colorCount) * 255 / colorCount)
+			nextCol[rowY] = [4]uint8{shade, shade, shade, 255}
+		}
+		colorGrid[colX] = nextCol
+	}
+	return colorGrid
+}
+
+/*
+ *  A big region of one color doesn't need a deep call stack
+ */
+func TestGetAllShapesLargeUniform(t *testing.T) {
+	var s ShapeExtractor
+	s.Init(getUniformColorGrid(1000, 1000))
+
+	allPolygons, allLines := s.GetAllShapes()
+
+	if len(allPolygons) != 1 || len(allLines) != 0 {
+		t.Errorf(
+			"Expected 1 polygon and 0 lines, but got %d and %d",
+			len(allPolygons),
+			len(allLines),
+		)
+	}
+	doneCount := s.doneCells.count()
+	if doneCount != s.ColCount*s.RowCount {
+		t.Errorf("Expected all %d cells to be done, but got %d", s.ColCount*s.RowCount, doneCount)
+	}
+}
+
+func benchmarkGetAllShapes(b *testing.B, colorGrid [][][4]uint8, traceEdges bool) {
+	b.ReportAllocs()
+	for index := 0; index < b.N; index++ {
+		var s ShapeExtractor
+		s.Init(colorGrid)
+		s.TraceEdges = traceEdges
+		s.GetAllShapes()
+	}
+}
+
+func BenchmarkGetAllShapesUniform(b *testing.B) {
+	benchmarkGetAllShapes(b, getUniformColorGrid(1000, 1000), false)
+}
+
+func BenchmarkGetAllShapesNoisy(b *testing.B) {
+	benchmarkGetAllShapes(b, getNoisyColorGrid(300, 300, 4), false)
+}
+
+func BenchmarkGetAllShapesUniformEdges(b *testing.B) {
+	benchmarkGetAllShapes(b, getUniformColorGrid(1000, 1000), true)
+}
+
+func BenchmarkGetAllShapesNoisyEdges(b *testing.B) {
+	benchmarkGetAllShapes(b, getNoisyColorGrid(300, 300, 4), true)
+}
+
+/*
+ *  Multi-megapixel grids, to check the memory the grid state takes
+ */
+func BenchmarkInitLarge(b *testing.B) {
+	colorGrid := getUniformColorGrid(2000, 2000)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for index := 0; index < b.N; index++ {
+		var s ShapeExtractor
+		s.Init(colorGrid)
+	}
+}
+
+func BenchmarkGetAllShapesLargeUniform(b *testing.B) {
+	benchmarkGetAllShapes(b, getUniformColorGrid(2000, 2000), false)
+}
+
+func BenchmarkGetAllShapesLargeNoisyEdges(b *testing.B) {
+	benchmarkGetAllShapes(b, getNoisyColorGrid(2000, 2000, 4), true)
+}
+
+func benchmarkConvert(b *testing.B, colorGrid [][][4]uint8, config Config) {
+	b.ReportAllocs()
+	for index := 0; index < b.N; index++ {
+		Convert(colorGrid, config)
+	}
+}
+
+func BenchmarkConvertNoisy(b *testing.B) {
+	benchmarkConvert(b, getNoisyColorGrid(1000, 1000, 4), Config{})
+}
+
+func BenchmarkConvertNoisyParallel(b *testing.B) {
+	benchmarkConvert(b, getNoisyColorGrid(1000, 1000, 4), Config{Parallel: true})
+}
+
+func BenchmarkConvertNoisyEdges(b *testing.B) {
+	benchmarkConvert(b, getNoisyColorGrid(1000, 1000, 4), Config{TraceEdges: true})
+}
+
+func BenchmarkConvertNoisyEdgesParallel(b *testing.B) {
+	benchmarkConvert(b, getNoisyColorGrid(1000, 1000, 4), Config{TraceEdges: true, Parallel: true})
+}
+
+/*
+ *  The outline of a square, going clockwise through every cell on its edge.
+ *  It has no overlaps, so the whole outline has to be checked.
+ */
+func getSquareOutline(size int) [][2]int {
+	outlinePoints := [][2]int{}
+	for index := 0; index < size-1; index++ {
+		outlinePoints = append(outlinePoints, [2]int{index, 0})
+	}
+	for index := 0; index < size-1; index++ {
+		outlinePoints = append(outlinePoints, [2]int{size - 1, index})
+	}
+	for index := size - 1; index > 0; index-- {
+		outlinePoints = append(outlinePoints, [2]int{index, size - 1})
+	}
+	for index := size - 1; index > 0; index-- {
+		outlinePoints = append(outlinePoints, [2]int{0, index})
+	}
+	return outlinePoints
+}
+
+func BenchmarkFindOutlineOverlap(b *testing.B) {
+	outlinePoints := getSquareOutline(2000)
+	b.ResetTimer()
+	for index := 0; index < b.N; index++ {
+		FindOutlineOverlap(outlinePoints)
+	}
+}
+
+func BenchmarkFindOutlineOverlapQuadratic(b *testing.B) {
+	outlinePoints := getSquareOutline(2000)
+	b.ResetTimer()
+	for index := 0; index < b.N; index++ {
+		findOutlineOverlapQuadratic(outlinePoints)
+	}
+}
+
+func BenchmarkCleanUpPolygonOutline(b *testing.B) {
+	outlinePoints := getRandomOutline(rand.New(rand.NewSource(1)), 5000, 100)
+	b.ResetTimer()
+	for index := 0; index < b.N; index++ {
+		CleanUpPolygonOutline(outlinePoints, [][][2]int{}, 0)
+	}
+}
+
+func BenchmarkCleanUpPolygonOutlineQuadratic(b *testing.B) {
+	outlinePoints := getRandomOutline(rand.New(rand.NewSource(1)), 5000, 100)
+	b.ResetTimer()
+	for index := 0; index < b.N; index++ {
+		cleanUpPolygonOutlineQuadratic(outlinePoints)
+	}
+}
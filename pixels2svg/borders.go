@@ -0,0 +1,280 @@
+package pixels2svg
+
+/*
+ * Shared borders
+ *
+ * When each region's outline is simplified on its own, the two sides of
+ * the border between neighboring regions end up different, leaving gaps
+ * and slivers. With SharedBorders, the outlines are split into arcs at the
+ * junctions (vertices where three or more regions meet, where regions only
+ * touch at a corner and at the corners of the grid). Each arc is simplified
+ * once and both regions use the same points, so they always meet exactly.
+ */
+
+// For each edge direction, the offsets from the vertex the edge starts at
+// to the cell on the walker's left (the other side of the region's outline)
+var leftCellOffsets = [4][2]int{{-1, -1}, {0, -1}, {0, 0}, {-1, 0}}
+
+/*
+ * Get the region of a cell, -1 for outside the grid and 0 for cells
+ * that aren't part of any region (e.g. transparent ones)
+ */
+func (s *ShapeExtractor) getCellRegion(colX, rowY int) int {
+	if colX < 0 || rowY < 0 || colX >= s.ColCount || rowY >= s.RowCount {
+		return -1
+	}
+	return s.regionLabels[colX*s.RowCount+rowY]
+}
+
+/*
+ * Is the vertex a place where arcs start and end: a corner of the grid,
+ * where three or more regions meet or where two regions only touch
+ * at a corner
+ */
+func (s *ShapeExtractor) isJunctionVertex(vertexX, vertexY int) bool {
+	isOnSide := vertexX == 0 || vertexX == s.ColCount
+	isOnTopOrBottom := vertexY == 0 || vertexY == s.RowCount
+	if isOnSide && isOnTopOrBottom {
+		return true
+	}
+
+	northWest := s.getCellRegion(vertexX-1, vertexY-1)
+	northEast := s.getCellRegion(vertexX, vertexY-1)
+	southWest := s.getCellRegion(vertexX-1, vertexY)
+	southEast := s.getCellRegion(vertexX, vertexY)
+
+	if northWest == southEast && northEast == southWest && northWest != northEast {
+		return true
+	}
+
+	distinctRegions := []int{northWest}
+	for _, nextRegion := range []int{northEast, southWest, southEast} {
+		isNew := true
+		for _, knownRegion := range distinctRegions {
+			if nextRegion == knownRegion {
+				isNew = false
+				break
+			}
+		}
+		if isNew {
+			distinctRegions = append(distinctRegions, nextRegion)
+		}
+	}
+	return len(distinctRegions) >= 3
+}
+
+/*
+ * Get the region on the other side of the edge between two vertices
+ * from the region whose outline it is
+ */
+func (s *ShapeExtractor) getOtherSideRegion(vertex1, vertex2 [2]int) int {
+	direction := 0
+	switch {
+	case vertex2[0] > vertex1[0]:
+		direction = 1
+	case vertex2[1] > vertex1[1]:
+		direction = 2
+	case vertex2[0] < vertex1[0]:
+		direction = 3
+	}
+	offset := leftCellOffsets[direction]
+	return s.getCellRegion(vertex1[0]+offset[0], vertex1[1]+offset[1])
+}
+
+func reversePoints(points [][2]int) [][2]int {
+	reversed := make([][2]int, len(points))
+	for index, nextPoint := range points {
+		reversed[len(points)-1-index] = nextPoint
+	}
+	return reversed
+}
+
+/*
+ * Rotate a closed outline so that it starts at its smallest vertex
+ * (by column, then row)
+ */
+func rotateToSmallestVertex(points [][2]int) [][2]int {
+	smallestIndex := 0
+	for index, nextPoint := range points {
+		smallest := points[smallestIndex]
+		if nextPoint[0] < smallest[0] || (nextPoint[0] == smallest[0] && nextPoint[1] < smallest[1]) {
+			smallestIndex = index
+		}
+	}
+	return append(append([][2]int{}, points[smallestIndex:]...), points[:smallestIndex]...)
+}
+
+/*
+ * Simplify an arc: keep its ends and the vertices where it turns,
+ * then apply the Simplifier, if there is one.
+ * A closed arc (a whole outline without junctions) is simplified
+ * as a polygon instead.
+ */
+func (s *ShapeExtractor) simplifyArc(arcPoints [][2]int, isClosed bool) [][2]int {
+	if isClosed {
+		return s.simplifyOutline(getTurningVertices(arcPoints))
+	}
+
+	newPoints := [][2]int{arcPoints[0]}
+	for index := 1; index < len(arcPoints)-1; index++ {
+		stepIn := [2]int{arcPoints[index][0] - arcPoints[index-1][0], arcPoints[index][1] - arcPoints[index-1][1]}
+		stepOut := [2]int{arcPoints[index+1][0] - arcPoints[index][0], arcPoints[index+1][1] - arcPoints[index][1]}
+		if stepIn != stepOut {
+			newPoints = append(newPoints, arcPoints[index])
+		}
+	}
+	newPoints = append(newPoints, arcPoints[len(arcPoints)-1])
+
+	if s.Simplifier == nil {
+		return newPoints
+	}
+	simplified := s.Simplifier.SimplifyPolyline(newPoints)
+	s.PointsRemoved += len(newPoints) - len(simplified)
+	return simplified
+}
+
+/*
+ * Get the simplified version of an arc of a region's outline, the same
+ * (only reversed) as for the region on its other side.
+ *
+ * Each arc is simplified in the direction the region with the lower number
+ * walks it. The result is kept until the other region asks for it.
+ */
+func (s *ShapeExtractor) getSharedArc(arcPoints [][2]int, region int, isClosed bool) [][2]int {
+	otherRegion := s.getOtherSideRegion(arcPoints[0], arcPoints[1])
+	isShared := otherRegion > 0
+	isReversed := isShared && otherRegion < region
+
+	canonicalPoints := arcPoints
+	if isReversed {
+		canonicalPoints = reversePoints(arcPoints)
+	}
+	if isClosed {
+		canonicalPoints = rotateToSmallestVertex(canonicalPoints)
+	}
+
+	arcKey := [4]int{canonicalPoints[0][0], canonicalPoints[0][1], canonicalPoints[1][0], canonicalPoints[1][1]}
+	simplified, found := s.sharedArcs[arcKey]
+	if found {
+		delete(s.sharedArcs, arcKey) // Both sides have it now
+	} else {
+		simplified = s.simplifyArc(canonicalPoints, isClosed)
+		if isShared {
+			s.sharedArcs[arcKey] = simplified
+		}
+	}
+
+	if isReversed {
+		return reversePoints(simplified)
+	}
+	return simplified
+}
+
+/*
+ * Given all the vertices of a region's outline (or of one of its holes),
+ * get its outline made up of the shared arcs
+ */
+func (s *ShapeExtractor) getSharedOutline(allVertices [][2]int, region int) [][2]int {
+	vertexCount := len(allVertices)
+	junctionIndexes := []int{}
+	for index, nextVertex := range allVertices {
+		if s.isJunctionVertex(nextVertex[0], nextVertex[1]) {
+			junctionIndexes = append(junctionIndexes, index)
+		}
+	}
+
+	if len(junctionIndexes) == 0 {
+		return s.getSharedArc(allVertices, region, true)
+	}
+
+	outlinePoints := [][2]int{}
+	for junctionIndex, startIndex := range junctionIndexes {
+		endIndex := junctionIndexes[(junctionIndex+1)%len(junctionIndexes)]
+		if endIndex <= startIndex {
+			endIndex += vertexCount
+		}
+
+		arcPoints := make([][2]int, 0, endIndex-startIndex+1)
+		for index := startIndex; index <= endIndex; index++ {
+			arcPoints = append(arcPoints, allVertices[index%vertexCount])
+		}
+
+		arcPoints = s.getSharedArc(arcPoints, region, false)
+		outlinePoints = append(outlinePoints, arcPoints[:len(arcPoints)-1]...)
+	}
+
+	return outlinePoints
+}
+
+/*
+ * Label every region first, so that the junctions are known before
+ * any outline is walked. Keeps each region's cells and color.
+ */
+func (s *ShapeExtractor) labelAllRegions() ([][2]int, []int, [][4]uint8) {
+	allRegionCells := [][2]int{}
+	regionCellStarts := []int{}
+	regionColors := [][4]uint8{}
+
+	region := 0
+	for rowIndex := 0; rowIndex < s.RowCount; rowIndex++ {
+		for colIndex := 0; colIndex < s.ColCount; colIndex++ {
+			if s.isDone(colIndex, rowIndex) {
+				continue
+			}
+			region++
+
+			color := s.getColor(colIndex, rowIndex)
+			regionCells := s.getRegionCells(colIndex, rowIndex, color)
+			for _, nextCell := range regionCells {
+				s.regionLabels[nextCell[0]*s.RowCount+nextCell[1]] = region
+			}
+
+			regionCellStarts = append(regionCellStarts, len(allRegionCells))
+			allRegionCells = append(allRegionCells, regionCells...)
+			regionColors = append(regionColors, s.getRegionColor(color))
+		}
+		s.rowScanned()
+		if s.checkContext() != nil {
+			break // processSharedRegions stops with the error
+		}
+	}
+	regionCellStarts = append(regionCellStarts, len(allRegionCells))
+
+	return allRegionCells, regionCellStarts, regionColors
+}
+
+/*
+ * Same as processRegions, but the regions share the (simplified) arcs of
+ * their borders with each other
+ */
+func (s *ShapeExtractor) processSharedRegions(emit func(Polygon) error) error {
+	allRegionCells, regionCellStarts, regionColors := s.labelAllRegions()
+	if err := s.checkContext(); err != nil {
+		return err
+	}
+	s.sharedArcs = map[[4]int][][2]int{}
+
+	for regionIndex, color := range regionColors {
+		region := regionIndex + 1
+		regionCells := allRegionCells[regionCellStarts[regionIndex]:regionCellStarts[regionIndex+1]]
+		colX, rowY := split2Int(regionCells[0])
+
+		outlineVertices := s.outlineRegionVertices(colX, rowY, 1, region)
+		allHoles := s.getRegionHoleVertices(regionCells, region)
+		for index, nextHole := range allHoles {
+			allHoles[index] = s.getSharedOutline(nextHole, region)
+		}
+
+		newPolygon := Polygon{
+			ColorRGBA: color,
+			Points:    s.getSharedOutline(outlineVertices, region),
+			Holes:     allHoles,
+		}
+		s.progress.PolygonsFound++
+		if err := emit(newPolygon); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,156 @@
+package pixels2svg
+
+import (
+	"fmt"
+	"testing"
+)
+
+/*
+ * Every edge between two vertices should be walked once in each direction
+ * (by the regions on either side of it), unless it's on the side of the grid.
+ */
+func checkBordersShared(allPolygons []Polygon, colCount, rowCount int) string {
+	edgeCounts := map[[4]int]int{}
+	for _, nextPolygon := range allPolygons {
+		for _, nextOutline := range append([][][2]int{nextPolygon.Points}, nextPolygon.Holes...) {
+			for index, nextPoint := range nextOutline {
+				followingPoint := nextOutline[(index+1)%len(nextOutline)]
+				edgeCounts[[4]int{nextPoint[0], nextPoint[1], followingPoint[0], followingPoint[1]}]++
+			}
+		}
+	}
+
+	for edge, count := range edgeCounts {
+		isOnSide := (edge[0] == edge[2] && (edge[0] == 0 || edge[0] == colCount)) ||
+			(edge[1] == edge[3] && (edge[1] == 0 || edge[1] == rowCount))
+		if isOnSide {
+			continue
+		}
+		reverseCount := edgeCounts[[4]int{edge[2], edge[3], edge[0], edge[1]}]
+		if count != 1 || reverseCount != 1 {
+			return fmt.Sprintf(
+				"\n For edge %v: Expected it once each way, but got %d and %d",
+				edge,
+				count,
+				reverseCount,
+			)
+		}
+	}
+	return ""
+}
+
+func getTotalDoubleArea(allPolygons []Polygon) int {
+	total := 0
+	for _, nextPolygon := range allPolygons {
+		total += getDoubleArea(nextPolygon.Points)
+		for _, nextHole := range nextPolygon.Holes {
+			total += getDoubleArea(nextHole) // Negative, since holes go counter-clockwise
+		}
+	}
+	return total
+}
+
+/*
+ * Without a simplifier, the regions should be the same as without
+ * shared borders (with a few extra points where borders meet)
+ */
+func TestProcessAllRegionsSharedBorders(t *testing.T) {
+	var s ShapeExtractor
+	s.Init(getBigColorGrid())
+	expected := s.ProcessAllRegions()
+
+	s.Init(getBigColorGrid())
+	s.SharedBorders = true
+	results := s.ProcessAllRegions()
+
+	if len(results) != len(expected) {
+		t.Errorf("Expected %d polygons, but got %d", len(expected), len(results))
+		return
+	}
+	for index, nextPolygon := range results {
+		resultsArea := getTotalDoubleArea([]Polygon{nextPolygon})
+		expectedArea := getTotalDoubleArea([]Polygon{expected[index]})
+		if resultsArea != expectedArea || nextPolygon.ColorRGBA != expected[index].ColorRGBA {
+			t.Errorf("Polygon %d. Expected area %d, but got %d", index, expectedArea, resultsArea)
+		}
+	}
+
+	errText := checkBordersShared(results, s.ColCount, s.RowCount)
+	if errText != "" {
+		t.Errorf("Borders. %s", errText)
+	}
+}
+
+/*
+ * Once simplified, neighboring regions should still meet exactly
+ * and cover the whole grid
+ */
+func TestProcessAllRegionsSharedBordersSimplified(t *testing.T) {
+	for name, simplifier := range map[string]Simplifier{
+		"DouglasPeucker":    DouglasPeucker{Tolerance: 1.5},
+		"VisvalingamWhyatt": VisvalingamWhyatt{Tolerance: 1.5},
+	} {
+		var s ShapeExtractor
+		s.Init(getBigColorGrid())
+		s.SharedBorders = true
+		s.Simplifier = simplifier
+
+		results := s.ProcessAllRegions()
+
+		errText := checkBordersShared(results, s.ColCount, s.RowCount)
+		if errText != "" {
+			t.Errorf("%s. Borders. %s", name, errText)
+		}
+
+		resultsArea := getTotalDoubleArea(results)
+		expectedArea := 2 * s.ColCount * s.RowCount
+		if resultsArea != expectedArea {
+			t.Errorf("%s. Expected a total area of %d, but got %d", name, expectedArea, resultsArea)
+		}
+
+		if s.PointsRemoved == 0 {
+			t.Errorf("%s. Expected the staircase border to be simplified", name)
+		}
+	}
+}
+
+/*
+ *     0   1   2   3
+ * 0 | B | B | B | B |
+ * 1 | A | B | B | B |
+ * 2 | A | A | B | B |
+ * 3 | A | A | A | B |
+ *
+ * Simplified on their own, B and A become triangles with a gap between them
+ */
+func TestProcessAllRegionsSharedBordersStaircase(t *testing.T) {
+	a := [4]uint8{1, 1, 1, 1}
+	b := [4]uint8{2, 2, 2, 2}
+
+	var s ShapeExtractor
+	s.Init([][][4]uint8{
+		{b, a, a, a},
+		{b, b, a, a},
+		{b, b, b, a},
+		{b, b, b, b},
+	})
+	s.SharedBorders = true
+	s.Simplifier = DouglasPeucker{Tolerance: 1.5}
+
+	results := s.ProcessAllRegions()
+	expected := []Polygon{
+		{
+			ColorRGBA: b,
+			Points:    [][2]int{{0, 0}, {4, 0}, {4, 4}, {3, 4}, {0, 1}},
+		},
+		{
+			ColorRGBA: a,
+			Points:    [][2]int{{0, 1}, {3, 4}, {0, 4}},
+		},
+	}
+
+	err := comparePolygons(results, expected)
+	if err != "" {
+		t.Errorf("\nPolygons. %s", err)
+	}
+}
@@ -0,0 +1,196 @@
+package pixels2svg
+
+import (
+	"math"
+)
+
+/*
+ * Conversions between sRGB and CIELAB (D65 white point).
+ * Distances in CIELAB match how different colors look much better than
+ * distances in RGB.
+ */
+
+// D65 reference white
+const (
+	whiteX = 0.95047
+	whiteY = 1.0
+	whiteZ = 1.08883
+)
+
+func srgbToLinear(channel uint8) float64 {
+	value := float64(channel) / 255
+	if value <= 0.04045 {
+		return value / 12.92
+	}
+	return math.Pow((value+0.055)/1.055, 2.4)
+}
+
+func linearToSRGB(value float64) uint8 {
+	if value <= 0.0031308 {
+		value *= 12.92
+	} else {
+		value = 1.055*math.Pow(value, 1/2.4) - 0.055
+	}
+	return uint8(math.Round(math.Max(0, math.Min(1, value)) * 255))
+}
+
+func labF(value float64) float64 {
+	if value > 216.0/24389.0 { // (6/29)^3
+		return math.Cbrt(value)
+	}
+	return value*841.0/108.0 + 4.0/29.0
+}
+
+func labFInverse(value float64) float64 {
+	if value > 6.0/29.0 {
+		return value * value * value
+	}
+	return (value - 4.0/29.0) * 108.0 / 841.0
+}
+
+/*
+ * Get the L*, a* and b* values of a color (alpha is ignored)
+ */
+func rgbToLab(colorRGBA [4]uint8) [3]float64 {
+	red := srgbToLinear(colorRGBA[0])
+	green := srgbToLinear(colorRGBA[1])
+	blue := srgbToLinear(colorRGBA[2])
+
+	x := labF((0.4124564*red + 0.3575761*green + 0.1804375*blue) / whiteX)
+	y := labF((0.2126729*red + 0.7151522*green + 0.0721750*blue) / whiteY)
+	z := labF((0.0193339*red + 0.1191920*green + 0.9503041*blue) / whiteZ)
+
+	return [3]float64{116*y - 16, 500 * (x - y), 200 * (y - z)}
+}
+
+/*
+ * Get the color for L*, a* and b* values, clamped to what sRGB can show
+ */
+func labToRGB(lab [3]float64, alpha uint8) [4]uint8 {
+	fy := (lab[0] + 16) / 116
+	x := whiteX * labFInverse(fy+lab[1]/500)
+	y := whiteY * labFInverse(fy)
+	z := whiteZ * labFInverse(fy-lab[2]/200)
+
+	return [4]uint8{
+		linearToSRGB(3.2404542*x - 1.5371385*y - 0.4985314*z),
+		linearToSRGB(-0.9692660*x + 1.8760108*y + 0.0415560*z),
+		linearToSRGB(0.0556434*x - 0.2040259*y + 1.0572252*z),
+		alpha,
+	}
+}
+
+/*
+ * A measure of how different two colors are. The larger, the more different.
+ */
+type ColorDistanceFunc func(color1, color2 [4]uint8) float64
+
+/*
+ * The straight-line distance between two colors in RGB (alpha is ignored).
+ * From 0 to about 441.7 (black to white).
+ */
+func EuclideanRGBDistance(color1, color2 [4]uint8) float64 {
+	total := 0.0
+	for channel := 0; channel < 3; channel++ {
+		difference := float64(color1[channel]) - float64(color2[channel])
+		total += difference * difference
+	}
+	return math.Sqrt(total)
+}
+
+/*
+ * The CIE ΔE2000 difference between two colors (alpha is ignored).
+ * About 1 is the smallest difference most people can see.
+ */
+func DeltaE2000Distance(color1, color2 [4]uint8) float64 {
+	if color1[0] == color2[0] && color1[1] == color2[1] && color1[2] == color2[2] {
+		return 0
+	}
+	return getDeltaE2000(rgbToLab(color1), rgbToLab(color2))
+}
+
+func toRadians(degrees float64) float64 {
+	return degrees * math.Pi / 180
+}
+
+/*
+ * Get a hue angle in degrees, from 0 up to 360
+ */
+func getHueDegrees(b, aPrime float64) float64 {
+	if b == 0 && aPrime == 0 {
+		return 0
+	}
+	hue := math.Atan2(b, aPrime) * 180 / math.Pi
+	if hue < 0 {
+		hue += 360
+	}
+	return hue
+}
+
+/*
+ * See "The CIEDE2000 Color-Difference Formula: Implementation Notes,
+ * Supplementary Test Data, and Mathematical Observations" (Sharma, Wu, Dalal)
+ */
+func getDeltaE2000(lab1, lab2 [3]float64) float64 {
+	pow25To7 := math.Pow(25, 7)
+
+	chroma1 := math.Hypot(lab1[1], lab1[2])
+	chroma2 := math.Hypot(lab2[1], lab2[2])
+	meanChroma7 := math.Pow((chroma1+chroma2)/2, 7)
+	g := 0.5 * (1 - math.Sqrt(meanChroma7/(meanChroma7+pow25To7)))
+
+	aPrime1 := (1 + g) * lab1[1]
+	aPrime2 := (1 + g) * lab2[1]
+	chromaPrime1 := math.Hypot(aPrime1, lab1[2])
+	chromaPrime2 := math.Hypot(aPrime2, lab2[2])
+	hue1 := getHueDegrees(lab1[2], aPrime1)
+	hue2 := getHueDegrees(lab2[2], aPrime2)
+
+	deltaL := lab2[0] - lab1[0]
+	deltaC := chromaPrime2 - chromaPrime1
+
+	deltaHue := 0.0
+	if chromaPrime1*chromaPrime2 != 0 {
+		deltaHue = hue2 - hue1
+		if deltaHue > 180 {
+			deltaHue -= 360
+		} else if deltaHue < -180 {
+			deltaHue += 360
+		}
+	}
+	deltaH := 2 * math.Sqrt(chromaPrime1*chromaPrime2) * math.Sin(toRadians(deltaHue/2))
+
+	meanL := (lab1[0] + lab2[0]) / 2
+	meanChromaPrime := (chromaPrime1 + chromaPrime2) / 2
+
+	meanHue := hue1 + hue2
+	if chromaPrime1*chromaPrime2 != 0 {
+		switch {
+		case math.Abs(hue1-hue2) <= 180:
+			meanHue /= 2
+		case hue1+hue2 < 360:
+			meanHue = (meanHue + 360) / 2
+		default:
+			meanHue = (meanHue - 360) / 2
+		}
+	}
+
+	t := 1 - 0.17*math.Cos(toRadians(meanHue-30)) +
+		0.24*math.Cos(toRadians(2*meanHue)) +
+		0.32*math.Cos(toRadians(3*meanHue+6)) -
+		0.20*math.Cos(toRadians(4*meanHue-63))
+	deltaTheta := 30 * math.Exp(-math.Pow((meanHue-275)/25, 2))
+	meanChromaPrime7 := math.Pow(meanChromaPrime, 7)
+	rotationC := 2 * math.Sqrt(meanChromaPrime7/(meanChromaPrime7+pow25To7))
+	meanLOffset2 := (meanL - 50) * (meanL - 50)
+	scaleL := 1 + 0.015*meanLOffset2/math.Sqrt(20+meanLOffset2)
+	scaleC := 1 + 0.045*meanChromaPrime
+	scaleH := 1 + 0.015*meanChromaPrime*t
+	rotationT := -math.Sin(toRadians(2*deltaTheta)) * rotationC
+
+	termL := deltaL / scaleL
+	termC := deltaC / scaleC
+	termH := deltaH / scaleH
+
+	return math.Sqrt(termL*termL + termC*termC + termH*termH + rotationT*termC*termH)
+}
@@ -0,0 +1,36 @@
+package pixels2svg
+
+import (
+	"math"
+	"testing"
+)
+
+/*
+ * Pairs from the test data of Sharma, Wu and Dalal
+ */
+func TestGetDeltaE2000(t *testing.T) {
+	allPairs := [][2][3]float64{
+		{{50, 2.6772, -79.7751}, {50, 0, -82.7485}},
+		{{50, 2.5, 0}, {50, 0, -2.5}},
+		{{50, 2.5, 0}, {56, -27, -3}},
+		{{60.2574, -34.0099, 36.2677}, {60.4626, -34.1751, 39.4387}},
+		{{90.9257, -0.5406, -0.9208}, {88.6381, -0.8985, -0.7239}},
+	}
+	expected := []float64{2.0425, 4.3065, 31.9030, 1.2644, 1.5381}
+
+	for index, nextPair := range allPairs {
+		results := getDeltaE2000(nextPair[0], nextPair[1])
+		if math.Abs(results-expected[index]) > 0.0001 {
+			t.Errorf("Pair %d. Expected %.4f, but got %.4f", index, expected[index], results)
+		}
+	}
+}
+
+func TestEuclideanRGBDistance(t *testing.T) {
+	results := EuclideanRGBDistance([4]uint8{1, 2, 3, 0}, [4]uint8{4, 6, 3, 255})
+	expected := 5.0
+
+	if results != expected {
+		t.Errorf("Expected %f, but got %f", expected, results)
+	}
+}
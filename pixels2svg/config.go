@@ -0,0 +1,129 @@
+package pixels2svg
+
+/*
+ * The options for a ShapeExtractor. The zero Config gives the original
+ * behavior: outlines through the pixel centers, exact colors, no alpha
+ * and one element per shape.
+ */
+type Config struct {
+	// Trace polygons along the pixel edges, with vertices on pixel corners,
+	// instead of through the pixel centers.
+	TraceEdges bool
+
+	// How to cover the grid with shapes: traced outlines (the default)
+	// or Rectangles.
+	Strategy Strategy
+
+	// Use the alpha values of the colors. Fully transparent cells don't get
+	// any shapes and partially transparent colors get an opacity.
+	UseAlpha bool
+
+	// Regions with fewer cells than this take the color of most of the
+	// cells around them before the shapes are found, to get rid of specks
+	// (e.g. from noise or antialiasing)
+	MinRegionSize int
+
+	// Keep every cell on the outlines of the polygons traced through the
+	// pixel centers, instead of only the ones where they turn
+	// (see ReducePolygonOutline)
+	SkipReduction bool
+
+	// Size of the svg element. By default, one unit per pixel.
+	// Set either or both of OutputWidth and OutputHeight, or set Scale
+	// to multiply the grid dimensions.
+	OutputWidth  float64
+	OutputHeight float64
+	Scale        float64
+
+	// Add shape-rendering="crispEdges", so that pixel art stays sharp
+	// when it's enlarged.
+	CrispEdges bool
+
+	// Start with an XML declaration, for standalone .svg files
+	XMLDeclaration bool
+
+	// Let neighboring cells with similar colors join the same shape.
+	// A cell joins if ColorDistance between its color and the color of the
+	// shape's first (seed) cell is at most ColorTolerance.
+	// ColorDistance defaults to EuclideanRGBDistance.
+	ColorTolerance float64
+	ColorDistance  ColorDistanceFunc
+
+	// The color to fill a shape with, when ColorTolerance lets cells of
+	// different colors join it.
+	RegionColor RegionColorMode
+
+	// Fit cubic Bezier curves to the outlines of the polygons, so that
+	// diagonal and curved edges look smooth when enlarged (see FitOutlineCurves).
+	// SmoothTolerance defaults to DefaultSmoothTolerance and CornerAngle
+	// to DefaultCornerAngle.
+	Smooth          bool
+	SmoothTolerance float64
+	CornerAngle     float64
+
+	// Simplify the outlines further than ReducePolygonOutline does, moving
+	// them by up to the simplifier's tolerance (e.g. DouglasPeucker or
+	// VisvalingamWhyatt). ShapeExtractor.PointsRemoved counts the points
+	// it has removed.
+	Simplifier Simplifier
+
+	// With TraceEdges, simplify each border between two regions once and
+	// use it for both, so that neighboring polygons always meet exactly.
+	SharedBorders bool
+
+	// Find the regions on several goroutines at once (GOMAXPROCS of them),
+	// working through the grid in tiles of TileSize by TileSize cells
+	// (DefaultTileSize by default). The shapes are the same as without it.
+	// The regions mustn't depend on the order the cells are found in, so
+	// writing the svg (or Convert) gives an error wrapping
+	// ErrParallelUnsupported with ColorTolerance, SharedBorders or the
+	// Rectangles strategy.
+	Parallel bool
+	TileSize int
+
+	// Limits for writing the svg and for Convert, to protect against
+	// pathological images. Going over one gives a *LimitError.
+	// Zero means no limit. An outline traced through the pixel centers
+	// also stops as soon as it has more than MaxPointsPerPolygon points,
+	// before it's reduced.
+	MaxGridSize         int // Cells in the grid (columns times rows)
+	MaxShapes           int
+	MaxPointsPerPolygon int // Including the points of its holes
+
+	// Called with the progress of finding the shapes and writing the svg
+	// (see Progress)
+	OnProgress func(Progress)
+
+	// Whether cells that only touch at a corner can be part of the same shape.
+	// With EightConnected, DiagonalTieBreak picks which color joins up where
+	// two colors cross each other diagonally (a 2 x 2 checkerboard).
+	Connectivity     Connectivity
+	DiagonalTieBreak DiagonalTieBreak
+
+	// Write all the shapes of one color as a single <path>, for much
+	// smaller files. The shapes are then kept in memory until all are found.
+	// Since the paths are no longer in the order the shapes were found, the
+	// shapes mustn't overlap, so the outlines are traced along the pixel
+	// edges, as with TraceEdges.
+	MergeByColor bool
+
+	// Write a <style> element with a rule for each color and give the
+	// shapes only a class, so that the colors can be changed in one place.
+	// ClassName names the class for each color, given the order in which
+	// the colors are found, and must return valid CSS class names.
+	// By default, the classes are named c0, c1, c2, ...
+	UseStyleSheet bool
+	ClassName     func(index int, colorRGBA [4]uint8) string
+}
+
+/*
+ * Get a ShapeExtractor for a grid of colors ([column][row]) with the given
+ * options. Same as setting the options and calling Init.
+ */
+func NewShapeExtractor(colorGrid [][][4]uint8, config Config) (*ShapeExtractor, error) {
+	s := &ShapeExtractor{Config: config}
+	if err := s.Init(colorGrid); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
@@ -0,0 +1,79 @@
+package pixels2svg
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestNewShapeExtractor(t *testing.T) {
+	s, err := NewShapeExtractor(getColorGrid(), Config{TraceEdges: true})
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+		return
+	}
+
+	results := s.ProcessAllRegions()
+	expected := []Polygon{
+		{ColorRGBA: [4]uint8{1, 1, 1, 1}, Points: [][2]int{{0, 0}, {5, 0}, {5, 4}, {0, 4}}},
+	}
+	errText := comparePolygons(results, expected)
+	if errText != "" {
+		t.Error(errText)
+	}
+
+	_, err = NewShapeExtractor([][][4]uint8{}, Config{})
+	if !errors.Is(err, ErrEmptyGrid) {
+		t.Errorf("Expected ErrEmptyGrid, but got %v", err)
+	}
+}
+
+/*
+ *    0  1  2  3  4
+ *  0 a  a  a  b  b
+ *  1 a  c  a  b  b
+ *  2 a  a  a  b  c
+ *  3 a  a  d  b  b
+ */
+func TestMinRegionSize(t *testing.T) {
+	a := [4]uint8{1, 1, 1, 255}
+	b := [4]uint8{2, 2, 2, 255}
+	c := [4]uint8{3, 3, 3, 255}
+	d := [4]uint8{4, 4, 4, 255}
+	colorGrid := [][][4]uint8{
+		{a, a, a, a}, // Column 0
+		{a, c, a, a}, // Column 1
+		{a, a, a, d}, // Column 2
+		{b, b, b, b}, // Column 3
+		{b, b, c, b}, // Column 4
+	}
+
+	s, _ := NewShapeExtractor(colorGrid, Config{TraceEdges: true, MinRegionSize: 2})
+	results := s.ProcessAllRegions()
+	expected := []Polygon{
+		{ColorRGBA: a, Points: [][2]int{{0, 0}, {3, 0}, {3, 4}, {0, 4}}},
+		{ColorRGBA: b, Points: [][2]int{{3, 0}, {5, 0}, {5, 4}, {3, 4}}},
+	}
+
+	errText := comparePolygons(results, expected)
+	if errText != "" {
+		t.Error(errText)
+	}
+	if colorGrid[1][1] != c {
+		t.Errorf("Expected the grid passed in to stay as it was, but cell 1,1 is %v", colorGrid[1][1])
+	}
+}
+
+func TestSkipReduction(t *testing.T) {
+	s, _ := NewShapeExtractor(getColorGrid(), Config{SkipReduction: true})
+
+	results := s.ProcessAllPolygons()
+	if len(results) != 1 {
+		t.Errorf("Expected 1 polygon, but got %d", len(results))
+		return
+	}
+
+	// Every cell around the edge of the 5 by 4 grid
+	if len(results[0].Points) != 14 {
+		t.Errorf("Expected 14 points, but got %d: %v", len(results[0].Points), results[0].Points)
+	}
+}
@@ -0,0 +1,96 @@
+package pixels2svg
+
+import (
+	"bytes"
+	"context"
+)
+
+/*
+ * Stateless conversion
+ *
+ * A ShapeExtractor keeps the state of the grid it's working through, so it
+ * can only be used by one goroutine at a time. Convert uses a new one for
+ * every call instead, so any number of conversions can run at the same
+ * time, even on the same grid, which is only read.
+ *
+ * Convert is safe for concurrent use, as long as the functions and the
+ * Simplifier in the Config (ColorDistance, ClassName, OnProgress, ...)
+ * are too. The distance functions, simplifiers and DefaultClassName in
+ * this package are, and so are the ColorMappers from MapColors and
+ * MapToPalette, for recoloring the results.
+ */
+
+/*
+ * The shapes found by Convert and the svg xml for them.
+ * With the Rectangles strategy, the shapes are in Rectangles only.
+ */
+type Result struct {
+	ColCount      int
+	RowCount      int
+	Polygons      []Polygon
+	Lines         []Line
+	Rectangles    []Rectangle
+	PointsRemoved int
+	SVG           string
+}
+
+/*
+ * Convert a grid of colors ([column][row]) into shapes and svg xml, using
+ * the options in config. Returns an error wrapping ErrEmptyGrid or
+ * ErrRaggedGrid if the grid can't be used, or a *LimitError if it's
+ * bigger than MaxGridSize.
+ */
+func Convert(colorGrid [][][4]uint8, config Config) (*Result, error) {
+	return ConvertContext(context.Background(), colorGrid, config)
+}
+
+/*
+ * Same as Convert, but stops with the context's error as soon as it's
+ * done. Also returns a *LimitError if one of the limits in the Config
+ * is hit.
+ */
+func ConvertContext(ctx context.Context, colorGrid [][][4]uint8, config Config) (*Result, error) {
+	s, err := NewShapeExtractor(colorGrid, config)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &Result{
+		ColCount:   s.ColCount,
+		RowCount:   s.RowCount,
+		Polygons:   []Polygon{},
+		Lines:      []Line{},
+		Rectangles: []Rectangle{},
+	}
+
+	// Keep each shape on its way to the svg
+	processShapes := func(
+		emitPolygon func(Polygon) error,
+		emitLine func(Line) error,
+		emitRectangle func(Rectangle) error,
+	) error {
+		return s.processAllShapes(
+			func(nextPolygon Polygon) error {
+				result.Polygons = append(result.Polygons, nextPolygon)
+				return emitPolygon(nextPolygon)
+			},
+			func(nextLine Line) error {
+				result.Lines = append(result.Lines, nextLine)
+				return emitLine(nextLine)
+			},
+			func(nextRectangle Rectangle) error {
+				result.Rectangles = append(result.Rectangles, nextRectangle)
+				return emitRectangle(nextRectangle)
+			},
+		)
+	}
+
+	var svgBuffer bytes.Buffer
+	if err := s.writeSVGDocument(ctx, &svgBuffer, processShapes); err != nil {
+		return nil, err
+	}
+
+	result.SVG = svgBuffer.String()
+	result.PointsRemoved = s.PointsRemoved
+	return result, nil
+}
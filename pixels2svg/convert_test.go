@@ -0,0 +1,93 @@
+package pixels2svg
+
+import (
+	"errors"
+	"sync"
+	"testing"
+)
+
+func TestConvert(t *testing.T) {
+	config := Config{TraceEdges: true}
+	result, err := Convert(getBigColorGrid(), config)
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+		return
+	}
+
+	s, _ := NewShapeExtractor(getBigColorGrid(), config)
+	expectedPolygons := s.ProcessAllRegions()
+
+	errText := comparePolygons(result.Polygons, expectedPolygons)
+	if errText != "" {
+		t.Error(errText)
+	}
+
+	s, _ = NewShapeExtractor(getBigColorGrid(), config)
+	expectedSVG := s.GetSVGText()
+	if result.SVG != expectedSVG {
+		t.Errorf("Expected svg\n%s\nbut got\n%s", expectedSVG, result.SVG)
+	}
+	if result.ColCount != 18 || result.RowCount != 12 {
+		t.Errorf("Expected an 18 by 12 grid, but got %d by %d", result.ColCount, result.RowCount)
+	}
+}
+
+func TestConvertRaggedGrid(t *testing.T) {
+	colorGrid := getColorGrid()
+	colorGrid[2] = colorGrid[2][:3]
+
+	result, err := Convert(colorGrid, Config{})
+	if !errors.Is(err, ErrRaggedGrid) {
+		t.Errorf("Expected ErrRaggedGrid, but got %v", err)
+	}
+	if result != nil {
+		t.Errorf("Expected no result, but got %v", result)
+	}
+}
+
+/*
+ * Many conversions of the same grid, with different options, at the same
+ * time give the same svg as one at a time (run with -race to check for
+ * shared state)
+ */
+func TestConvertConcurrent(t *testing.T) {
+	colorGrid := getNoisyColorGrid(40, 30, 4)
+	allConfigs := []Config{
+		{},
+		{TraceEdges: true},
+		{TraceEdges: true, SharedBorders: true, Simplifier: DouglasPeucker{Tolerance: 1}},
+		{Strategy: Rectangles, UseStyleSheet: true},
+		{MergeByColor: true, MinRegionSize: 3},
+		{ColorTolerance: 100, RegionColor: MeanColor},
+	}
+
+	expectedSVGs := []string{}
+	for _, config := range allConfigs {
+		result, err := Convert(colorGrid, config)
+		if err != nil {
+			t.Errorf("Unexpected error: %v", err)
+			return
+		}
+		expectedSVGs = append(expectedSVGs, result.SVG)
+	}
+
+	var waitGroup sync.WaitGroup
+	resultSVGs := make([]string, len(allConfigs)*4)
+	for index := range resultSVGs {
+		waitGroup.Add(1)
+		go func(index int) {
+			defer waitGroup.Done()
+			result, err := Convert(colorGrid, allConfigs[index%len(allConfigs)])
+			if err == nil {
+				resultSVGs[index] = result.SVG
+			}
+		}(index)
+	}
+	waitGroup.Wait()
+
+	for index, results := range resultSVGs {
+		if results != expectedSVGs[index%len(allConfigs)] {
+			t.Errorf("Conversion %d with config %d gave a different svg", index, index%len(allConfigs))
+		}
+	}
+}
@@ -0,0 +1,387 @@
+package pixels2svg
+
+import (
+	"math"
+)
+
+/*
+ * Curve fitting
+ *
+ * Traced outlines are made of short straight steps, which look jagged when
+ * they are enlarged. These functions fit cubic Bezier curves to an outline,
+ * within an error tolerance, and keep the sharp corners it has.
+ * The fitting follows "An Algorithm for Automatically Fitting Digitized
+ * Curves" (Philip J. Schneider, Graphics Gems, 1990).
+ */
+
+const (
+	DefaultSmoothTolerance = 0.5  // Pixels
+	DefaultCornerAngle     = 60.0 // Degrees
+
+	// Edges shorter than this are steps of a staircase, not sides of a corner
+	cornerMinEdgeLength = 2.0
+
+	maxReparameterizeIterations = 4
+)
+
+type BezierSegment struct {
+	Start    [2]float64
+	Control1 [2]float64
+	Control2 [2]float64
+	End      [2]float64
+}
+
+func addPoints(point1, point2 [2]float64) [2]float64 {
+	return [2]float64{point1[0] + point2[0], point1[1] + point2[1]}
+}
+
+func subtractPoints(point1, point2 [2]float64) [2]float64 {
+	return [2]float64{point1[0] - point2[0], point1[1] - point2[1]}
+}
+
+func scalePoint(point [2]float64, scale float64) [2]float64 {
+	return [2]float64{point[0] * scale, point[1] * scale}
+}
+
+func dotProduct(point1, point2 [2]float64) float64 {
+	return point1[0]*point2[0] + point1[1]*point2[1]
+}
+
+func getPointLength(point [2]float64) float64 {
+	return math.Hypot(point[0], point[1])
+}
+
+func normalizePoint(point [2]float64) [2]float64 {
+	length := getPointLength(point)
+	if length == 0 {
+		return point
+	}
+	return scalePoint(point, 1/length)
+}
+
+func toFloatPoint(point [2]int) [2]float64 {
+	return [2]float64{float64(point[0]), float64(point[1])}
+}
+
+/*
+ * Get the point on a Bezier curve at t (from 0 at its start to 1 at its end)
+ */
+func (b BezierSegment) PointAt(t float64) [2]float64 {
+	mt := 1 - t
+	point := scalePoint(b.Start, mt*mt*mt)
+	point = addPoints(point, scalePoint(b.Control1, 3*mt*mt*t))
+	point = addPoints(point, scalePoint(b.Control2, 3*mt*t*t))
+	return addPoints(point, scalePoint(b.End, t*t*t))
+}
+
+/*
+ * Get the first and second derivatives of a Bezier curve at t
+ */
+func (b BezierSegment) getDerivatives(t float64) ([2]float64, [2]float64) {
+	mt := 1 - t
+	d1 := scalePoint(subtractPoints(b.Control1, b.Start), 3)
+	d2 := scalePoint(subtractPoints(b.Control2, b.Control1), 3)
+	d3 := scalePoint(subtractPoints(b.End, b.Control2), 3)
+
+	firstDerivative := addPoints(
+		addPoints(scalePoint(d1, mt*mt), scalePoint(d2, 2*mt*t)),
+		scalePoint(d3, t*t),
+	)
+	secondDerivative := addPoints(
+		scalePoint(subtractPoints(d2, d1), 2*mt),
+		scalePoint(subtractPoints(d3, d2), 2*t),
+	)
+	return firstDerivative, secondDerivative
+}
+
+/*
+ * Find which points of a closed outline are corners, where it turns by at
+ * least cornerAngle degrees between two edges that are both long enough not
+ * to be the steps of a staircase.
+ */
+func getOutlineCorners(outlinePoints [][2]int, cornerAngle float64) []bool {
+	pointCount := len(outlinePoints)
+	isCorner := make([]bool, pointCount)
+
+	for index, nextPoint := range outlinePoints {
+		point := toFloatPoint(nextPoint)
+		prevPoint := toFloatPoint(outlinePoints[(index+pointCount-1)%pointCount])
+		followingPoint := toFloatPoint(outlinePoints[(index+1)%pointCount])
+
+		edgeIn := subtractPoints(point, prevPoint)
+		edgeOut := subtractPoints(followingPoint, point)
+		lengthIn := getPointLength(edgeIn)
+		lengthOut := getPointLength(edgeOut)
+		if lengthIn < cornerMinEdgeLength || lengthOut < cornerMinEdgeLength {
+			continue
+		}
+
+		cosine := math.Max(-1, math.Min(1, dotProduct(edgeIn, edgeOut)/(lengthIn*lengthOut)))
+		isCorner[index] = math.Acos(cosine)*180/math.Pi >= cornerAngle
+	}
+
+	return isCorner
+}
+
+/*
+ * Get the points to fit the curves to. Each edge gives the points half a
+ * pixel in from both its ends (just its middle if it's a single step), so
+ * that staircases turn into straight diagonals. Corners are kept as they are.
+ */
+func getOutlineSamples(outlinePoints [][2]int, isCorner []bool) ([][2]float64, []bool) {
+	pointCount := len(outlinePoints)
+	samples := [][2]float64{}
+	isSampleCorner := []bool{}
+
+	for index, nextPoint := range outlinePoints {
+		point := toFloatPoint(nextPoint)
+		followingPoint := toFloatPoint(outlinePoints[(index+1)%pointCount])
+
+		if isCorner[index] {
+			samples = append(samples, point)
+			isSampleCorner = append(isSampleCorner, true)
+		}
+
+		edge := subtractPoints(followingPoint, point)
+		edgeLength := getPointLength(edge)
+		if edgeLength == 0 {
+			continue
+		}
+		if edgeLength <= 1 {
+			samples = append(samples, addPoints(point, scalePoint(edge, 0.5)))
+			isSampleCorner = append(isSampleCorner, false)
+			continue
+		}
+
+		halfStep := scalePoint(edge, 0.5/edgeLength)
+		samples = append(samples, addPoints(point, halfStep), subtractPoints(followingPoint, halfStep))
+		isSampleCorner = append(isSampleCorner, false, false)
+	}
+
+	return samples, isSampleCorner
+}
+
+/*
+ * Fit cubic Bezier curves to a closed outline, so that no sample point is
+ * further than tolerance from them. Points where the outline turns by at
+ * least cornerAngle degrees (between edges that are at least two pixels
+ * long) stay sharp corners.
+ *
+ * The curves are in order around the outline, each one starting where
+ * the previous one ends and the last one ending where the first one starts.
+ */
+func FitOutlineCurves(outlinePoints [][2]int, tolerance, cornerAngle float64) []BezierSegment {
+	if len(outlinePoints) < 3 {
+		return nil
+	}
+
+	samples, isCorner := getOutlineSamples(outlinePoints, getOutlineCorners(outlinePoints, cornerAngle))
+	sampleCount := len(samples)
+	if sampleCount < 2 {
+		return nil
+	}
+	toleranceSquared := tolerance * tolerance
+
+	firstCorner := -1
+	for index, nextIsCorner := range isCorner {
+		if nextIsCorner {
+			firstCorner = index
+			break
+		}
+	}
+
+	// No corners: one smooth loop, with the same tangent where it closes
+	if firstCorner < 0 {
+		loopPoints := append(append([][2]float64{}, samples...), samples[0])
+		tangent := normalizePoint(subtractPoints(samples[1], samples[sampleCount-1]))
+		return fitCubic(loopPoints, tangent, scalePoint(tangent, -1), toleranceSquared)
+	}
+
+	// Otherwise, fit each run of samples from one corner to the next
+	allCurves := []BezierSegment{}
+	runPoints := [][2]float64{samples[firstCorner]}
+	for offset := 1; offset <= sampleCount; offset++ {
+		index := (firstCorner + offset) % sampleCount
+		runPoints = append(runPoints, samples[index])
+		if !isCorner[index] {
+			continue
+		}
+
+		runCount := len(runPoints)
+		tangent1 := normalizePoint(subtractPoints(runPoints[1], runPoints[0]))
+		tangent2 := normalizePoint(subtractPoints(runPoints[runCount-2], runPoints[runCount-1]))
+		allCurves = append(allCurves, fitCubic(runPoints, tangent1, tangent2, toleranceSquared)...)
+		runPoints = [][2]float64{samples[index]}
+	}
+
+	return allCurves
+}
+
+/*
+ * Fit curves to the points, starting off in the direction of tangent1 and
+ * arriving from the direction of tangent2 (pointing back from the end).
+ * If one curve is too far from the points, split them where it's furthest
+ * and fit each half.
+ */
+func fitCubic(points [][2]float64, tangent1, tangent2 [2]float64, toleranceSquared float64) []BezierSegment {
+	pointCount := len(points)
+	first := points[0]
+	last := points[pointCount-1]
+
+	if pointCount == 2 {
+		distance := getPointLength(subtractPoints(last, first)) / 3
+		return []BezierSegment{{
+			Start:    first,
+			Control1: addPoints(first, scalePoint(tangent1, distance)),
+			Control2: addPoints(last, scalePoint(tangent2, distance)),
+			End:      last,
+		}}
+	}
+
+	params := getChordLengthParams(points)
+	curve := generateBezier(points, params, tangent1, tangent2)
+	maxError, splitIndex := getMaxFitError(points, params, curve)
+	if maxError <= toleranceSquared {
+		return []BezierSegment{curve}
+	}
+
+	// Close enough to improve by moving the points along the curve
+	if maxError <= toleranceSquared*4 {
+		for iteration := 0; iteration < maxReparameterizeIterations; iteration++ {
+			params = reparameterize(points, params, curve)
+			curve = generateBezier(points, params, tangent1, tangent2)
+			maxError, splitIndex = getMaxFitError(points, params, curve)
+			if maxError <= toleranceSquared {
+				return []BezierSegment{curve}
+			}
+		}
+	}
+
+	centerTangent := normalizePoint(subtractPoints(points[splitIndex-1], points[splitIndex+1]))
+	if centerTangent == [2]float64{} {
+		centerTangent = normalizePoint(subtractPoints(points[splitIndex-1], points[splitIndex]))
+	}
+
+	allCurves := fitCubic(points[:splitIndex+1], tangent1, centerTangent, toleranceSquared)
+	return append(
+		allCurves,
+		fitCubic(points[splitIndex:], scalePoint(centerTangent, -1), tangent2, toleranceSquared)...,
+	)
+}
+
+/*
+ * Give each point a parameter from 0 to 1, by its distance along the points
+ */
+func getChordLengthParams(points [][2]float64) []float64 {
+	params := make([]float64, len(points))
+	for index := 1; index < len(points); index++ {
+		params[index] = params[index-1] + getPointLength(subtractPoints(points[index], points[index-1]))
+	}
+
+	total := params[len(params)-1]
+	for index := range params {
+		if total == 0 {
+			params[index] = float64(index) / float64(len(params)-1)
+		} else {
+			params[index] /= total
+		}
+	}
+	return params
+}
+
+/*
+ * Find the control points, along the tangents, of the curve that is closest
+ * to the points (least squares) at their parameters
+ */
+func generateBezier(points [][2]float64, params []float64, tangent1, tangent2 [2]float64) BezierSegment {
+	first := points[0]
+	last := points[len(points)-1]
+
+	c00, c01, c11 := 0.0, 0.0, 0.0
+	x0, x1 := 0.0, 0.0
+
+	for index, point := range points {
+		t := params[index]
+		mt := 1 - t
+		b0 := mt * mt * mt
+		b1 := 3 * mt * mt * t
+		b2 := 3 * mt * t * t
+		b3 := t * t * t
+
+		a0 := scalePoint(tangent1, b1)
+		a1 := scalePoint(tangent2, b2)
+		c00 += dotProduct(a0, a0)
+		c01 += dotProduct(a0, a1)
+		c11 += dotProduct(a1, a1)
+
+		endpointsOnly := addPoints(scalePoint(first, b0+b1), scalePoint(last, b2+b3))
+		difference := subtractPoints(point, endpointsOnly)
+		x0 += dotProduct(a0, difference)
+		x1 += dotProduct(a1, difference)
+	}
+
+	alpha1, alpha2 := 0.0, 0.0
+	determinant := c00*c11 - c01*c01
+	if determinant != 0 {
+		alpha1 = (x0*c11 - x1*c01) / determinant
+		alpha2 = (c00*x1 - c01*x0) / determinant
+	}
+
+	// If the fit is no good, fall back on control points a third of the way along
+	segmentLength := getPointLength(subtractPoints(last, first))
+	epsilon := 1.0e-6 * segmentLength
+	if alpha1 < epsilon || alpha2 < epsilon {
+		alpha1 = segmentLength / 3
+		alpha2 = alpha1
+	}
+
+	return BezierSegment{
+		Start:    first,
+		Control1: addPoints(first, scalePoint(tangent1, alpha1)),
+		Control2: addPoints(last, scalePoint(tangent2, alpha2)),
+		End:      last,
+	}
+}
+
+/*
+ * Get the largest squared distance between a point and the curve at the
+ * point's parameter, and the index of that point (never the first or last).
+ */
+func getMaxFitError(points [][2]float64, params []float64, curve BezierSegment) (float64, int) {
+	maxError := 0.0
+	splitIndex := len(points) / 2
+
+	for index := 1; index < len(points)-1; index++ {
+		difference := subtractPoints(curve.PointAt(params[index]), points[index])
+		distance := dotProduct(difference, difference)
+		if distance >= maxError {
+			maxError = distance
+			splitIndex = index
+		}
+	}
+
+	return maxError, splitIndex
+}
+
+/*
+ * Move each parameter to where the curve is closest to its point
+ * (one Newton-Raphson step each)
+ */
+func reparameterize(points [][2]float64, params []float64, curve BezierSegment) []float64 {
+	newParams := make([]float64, len(params))
+
+	for index, t := range params {
+		difference := subtractPoints(curve.PointAt(t), points[index])
+		firstDerivative, secondDerivative := curve.getDerivatives(t)
+
+		numerator := dotProduct(difference, firstDerivative)
+		denominator := dotProduct(firstDerivative, firstDerivative) + dotProduct(difference, secondDerivative)
+		if denominator == 0 {
+			newParams[index] = t
+			continue
+		}
+		newParams[index] = math.Max(0, math.Min(1, t-numerator/denominator))
+	}
+
+	return newParams
+}
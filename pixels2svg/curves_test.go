@@ -0,0 +1,120 @@
+package pixels2svg
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"testing"
+)
+
+/*
+ * Check that each curve starts where the previous one ends, all the way round
+ */
+func checkCurvesClosed(allCurves []BezierSegment) string {
+	for index, nextCurve := range allCurves {
+		prevCurve := allCurves[(index+len(allCurves)-1)%len(allCurves)]
+		if getPointLength(subtractPoints(nextCurve.Start, prevCurve.End)) > 1e-9 {
+			return fmt.Sprintf(
+				"\n For curve %d: Expected it to start at %v, but got %v",
+				index,
+				prevCurve.End,
+				nextCurve.Start,
+			)
+		}
+	}
+	return ""
+}
+
+/*
+ * A disc traced along the pixel edges is a circle of staircases.
+ * The curves should stay close to the circle and need far fewer points.
+ */
+func TestFitOutlineCurvesDisc(t *testing.T) {
+	radius := 10.0
+	center := 12.0
+	a := [4]uint8{1, 1, 1, 1}
+	b := [4]uint8{2, 2, 2, 2}
+
+	colorGrid := [][][4]uint8{}
+	for colX := 0; colX < 24; colX++ {
+		nextCol := [][4]uint8{}
+		for rowY := 0; rowY < 24; rowY++ {
+			if math.Hypot(float64(colX)+0.5-center, float64(rowY)+0.5-center) <= radius {
+				nextCol = append(nextCol, b)
+			} else {
+				nextCol = append(nextCol, a)
+			}
+		}
+		colorGrid = append(colorGrid, nextCol)
+	}
+
+	var s ShapeExtractor
+	s.Init(colorGrid)
+	allPolygons := s.ProcessAllRegions()
+	if len(allPolygons) != 2 {
+		t.Errorf("Expected 2 regions, but got %d", len(allPolygons))
+		return
+	}
+	discOutline := allPolygons[0].Holes[0]
+
+	allCurves := FitOutlineCurves(discOutline, DefaultSmoothTolerance, DefaultCornerAngle)
+
+	errText := checkCurvesClosed(allCurves)
+	if errText != "" {
+		t.Errorf("Curves not closed. %s", errText)
+	}
+	if len(allCurves) == 0 || len(allCurves) >= len(discOutline)/2 {
+		t.Errorf("Expected far fewer curves than the %d outline points, but got %d", len(discOutline), len(allCurves))
+	}
+
+	for index, nextCurve := range allCurves {
+		for step := 0; step <= 10; step++ {
+			point := nextCurve.PointAt(float64(step) / 10)
+			distance := math.Hypot(point[0]-center, point[1]-center)
+			if math.Abs(distance-radius) > 1 {
+				t.Errorf("Curve %d at %v is %.3f from the center, expected about %.1f", index, point, distance, radius)
+				return
+			}
+		}
+	}
+}
+
+/*
+ * A rectangle has long sides, so its corners stay sharp
+ */
+func TestFitOutlineCurvesKeepsCorners(t *testing.T) {
+	outlinePoints := [][2]int{{0, 0}, {6, 0}, {6, 4}, {0, 4}}
+
+	allCurves := FitOutlineCurves(outlinePoints, DefaultSmoothTolerance, DefaultCornerAngle)
+	if len(allCurves) != 4 {
+		t.Errorf("Expected 4 curves, but got %d", len(allCurves))
+		return
+	}
+
+	errText := checkCurvesClosed(allCurves)
+	if errText != "" {
+		t.Errorf("Curves not closed. %s", errText)
+	}
+
+	for index, nextCurve := range allCurves {
+		expected := toFloatPoint(outlinePoints[index])
+		if nextCurve.Start != expected {
+			t.Errorf("Curve %d. Expected it to start at corner %v, but got %v", index, expected, nextCurve.Start)
+		}
+	}
+}
+
+func TestGetSVGTextSmooth(t *testing.T) {
+	var s ShapeExtractor
+	s.Init(getColorGrid())
+	s.TraceEdges = true
+	s.Smooth = true
+
+	results := s.GetSVGText()
+	expected := `  <path class="#010101" d="M0,0 C1.667,0 3.333,0 5,0 C5,1.333 5,2.667 5,4 ` +
+		`C3.333,4 1.667,4 0,4 C0,2.667 0,1.333 0,0 Z " fill-rule="evenodd" fill="#010101" />`
+
+	if !strings.Contains(results, expected) {
+		t.Errorf("Expected the svg to contain\n%s\nbut got\n%s", expected, results)
+	}
+}
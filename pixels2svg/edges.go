@@ -0,0 +1,368 @@
+package pixels2svg
+
+import (
+	"fmt"
+)
+
+/*
+ * Edge tracing
+ *
+ * Instead of walking from cell center to cell center (see OutlinePolygon),
+ * these functions walk along the edges of the pixels, so that every vertex
+ * sits on a pixel corner (0..ColCount, 0..RowCount). The resulting polygons
+ * tile the canvas exactly and render back to the original grid.
+ *
+ * Edge direction codes (direction of travel)
+ *  0: North
+ *  1: East
+ *  2: South
+ *  3: West
+ */
+
+// Column and row offsets for each edge direction
+var edgeOffsets = [4][2]int{{0, -1}, {1, 0}, {0, 1}, {-1, 0}}
+
+// For each edge direction, the offsets from the vertex the edge starts at
+// to the cell on the walker's right (the region's side of its outline)
+var rightCellOffsets = [4][2]int{{0, -1}, {0, 0}, {-1, 0}, {-1, -1}}
+
+/*
+ * Make sure there are region labels and used edges for the whole grid,
+ * for when the region functions are called directly
+ */
+func (s *ShapeExtractor) ensureRegionBuffers() {
+	if len(s.regionLabels) != s.ColCount*s.RowCount {
+		s.regionLabels = make([]int, s.ColCount*s.RowCount)
+	}
+	if len(s.usedEdges) != (s.ColCount+1)*(s.RowCount+1)*4 {
+		s.usedEdges = make([]bool, (s.ColCount+1)*(s.RowCount+1)*4)
+	}
+}
+
+/*
+ * Get the index in usedEdges of the edge from a vertex in a direction.
+ * Each edge has its own entry, rather than a bit of a shared one, so that
+ * regions can be walked at the same time (see processRegionsInParallel).
+ */
+func (s *ShapeExtractor) getEdgeIndex(vertexX, vertexY, direction int) int {
+	return (vertexX*(s.RowCount+1)+vertexY)*4 + direction
+}
+
+/*
+ * Check that the edge from a vertex in a direction is on the outline of
+ * a region, with the region on its right, so that walking it gets back
+ * to where it started
+ */
+func (s *ShapeExtractor) checkOutlineEdge(vertexX, vertexY, direction, region int) error {
+	if err := checkDirection(direction, 4); err != nil {
+		return err
+	}
+	if vertexX < 0 || vertexY < 0 || vertexX > s.ColCount || vertexY > s.RowCount {
+		return fmt.Errorf(
+			"%w: vertex %d,%d isn't on the %d by %d grid",
+			ErrOutOfRange,
+			vertexX,
+			vertexY,
+			s.ColCount,
+			s.RowCount,
+		)
+	}
+
+	rightOffset := rightCellOffsets[direction]
+	leftOffset := leftCellOffsets[direction]
+	isOnOutline := s.isCellInRegion(vertexX+rightOffset[0], vertexY+rightOffset[1], region) &&
+		!s.isCellInRegion(vertexX+leftOffset[0], vertexY+leftOffset[1], region)
+	if !isOnOutline {
+		return fmt.Errorf(
+			"%w: the edge from vertex %d,%d in direction %d isn't on the outline of region %d",
+			ErrNotOnOutline,
+			vertexX,
+			vertexY,
+			direction,
+			region,
+		)
+	}
+	return nil
+}
+
+/*
+ *  Is the cell inside the grid and part of the given region
+ */
+func (s *ShapeExtractor) isCellInRegion(colX, rowY, region int) bool {
+	if colX < 0 || rowY < 0 || colX >= s.ColCount || rowY >= s.RowCount {
+		return false
+	}
+	return s.regionLabels[colX*s.RowCount+rowY] == region
+}
+
+/*
+ * Given a vertex (pixel corner) on the outline of a region and the direction
+ * the walker arrived in, get the direction of the next edge.
+ *
+ * The walker keeps the region on its right, so outer outlines go clockwise
+ * and hole outlines go counter-clockwise.
+ * Where two region cells only touch at this corner, the walker turns left
+ * if the cells are joined and right if they are not.
+ */
+func (s *ShapeExtractor) getNextEdgeDirection(vertexX, vertexY, direction, region int) int {
+	northWest := s.isCellInRegion(vertexX-1, vertexY-1, region)
+	northEast := s.isCellInRegion(vertexX, vertexY-1, region)
+	southWest := s.isCellInRegion(vertexX-1, vertexY, region)
+	southEast := s.isCellInRegion(vertexX, vertexY, region)
+
+	if northWest && southEast && !northEast && !southWest {
+		if s.areDiagonalCellsJoined(vertexX-1, vertexY-1, vertexX, vertexY) {
+			return (direction + 3) % 4
+		}
+		return (direction + 1) % 4
+	}
+	if northEast && southWest && !northWest && !southEast {
+		if s.areDiagonalCellsJoined(vertexX, vertexY-1, vertexX-1, vertexY) {
+			return (direction + 3) % 4
+		}
+		return (direction + 1) % 4
+	}
+
+	switch {
+	case southEast && !northEast:
+		return 1 // East, along the top of the south-east cell
+	case southWest && !southEast:
+		return 2 // South, along the right of the south-west cell
+	case northWest && !southWest:
+		return 3 // West, along the bottom of the north-west cell
+	}
+	return 0 // North, along the left of the north-east cell
+}
+
+/*
+ * Walk the edges of a region, starting at a vertex and heading in a
+ * certain direction, until getting back to that first edge.
+ * Marks the edges it walks as used.
+ * Returns only the vertices where the outline changes direction, or an
+ * error wrapping ErrOutOfRange if the vertex or direction isn't valid, or
+ * ErrNotOnOutline if that first edge isn't on the region's outline (with
+ * the region on its right).
+ */
+func (s *ShapeExtractor) OutlineRegionEdges(vertexX, vertexY, direction, region int) ([][2]int, error) {
+	s.ensureRegionBuffers()
+	if err := s.checkOutlineEdge(vertexX, vertexY, direction, region); err != nil {
+		return nil, err
+	}
+	return getTurningVertices(s.outlineRegionVertices(vertexX, vertexY, direction, region)), nil
+}
+
+/*
+ * Same as OutlineRegionEdges, but returns every vertex it walks through,
+ * starting with the first one.
+ */
+func (s *ShapeExtractor) outlineRegionVertices(vertexX, vertexY, direction, region int) [][2]int {
+	startX := vertexX
+	startY := vertexY
+	startDirection := direction
+	allVertices := [][2]int{{startX, startY}}
+
+	for {
+		s.usedEdges[s.getEdgeIndex(vertexX, vertexY, direction)] = true
+		vertexX += edgeOffsets[direction][0]
+		vertexY += edgeOffsets[direction][1]
+
+		newDirection := s.getNextEdgeDirection(vertexX, vertexY, direction, region)
+		if vertexX == startX && vertexY == startY && newDirection == startDirection {
+			break
+		}
+		allVertices = append(allVertices, [2]int{vertexX, vertexY})
+		direction = newDirection
+	}
+
+	return allVertices
+}
+
+/*
+ * Given all the vertices of a closed outline (one step apart), get the
+ * ones where it changes direction, in the same order
+ */
+func getTurningVertices(allVertices [][2]int) [][2]int {
+	vertexCount := len(allVertices)
+	turningVertices := [][2]int{}
+
+	for index, nextVertex := range allVertices {
+		prevVertex := allVertices[(index+vertexCount-1)%vertexCount]
+		followingVertex := allVertices[(index+1)%vertexCount]
+		stepIn := [2]int{nextVertex[0] - prevVertex[0], nextVertex[1] - prevVertex[1]}
+		stepOut := [2]int{followingVertex[0] - nextVertex[0], followingVertex[1] - nextVertex[1]}
+		if stepIn != stepOut {
+			turningVertices = append(turningVertices, nextVertex)
+		}
+	}
+
+	return turningVertices
+}
+
+/*
+ * Given a cell and a side of it (the edge direction when walking that side
+ * clockwise), is that side on an outline of the cell's region that has not
+ * been walked yet. If so, also get the vertex that side starts from.
+ */
+func (s *ShapeExtractor) getUnusedOutlineEdge(colX, rowY, direction, region int) (bool, int, int) {
+	var vertexX, vertexY int
+	var outsideCol, outsideRow int
+
+	switch direction {
+	case 0: // Left side, going North
+		vertexX, vertexY = colX, rowY+1
+		outsideCol, outsideRow = colX-1, rowY
+	case 1: // Top side, going East
+		vertexX, vertexY = colX, rowY
+		outsideCol, outsideRow = colX, rowY-1
+	case 2: // Right side, going South
+		vertexX, vertexY = colX+1, rowY
+		outsideCol, outsideRow = colX+1, rowY
+	default: // Bottom side, going West
+		vertexX, vertexY = colX+1, rowY+1
+		outsideCol, outsideRow = colX, rowY+1
+	}
+
+	if s.isCellInRegion(outsideCol, outsideRow, region) {
+		return false, 0, 0
+	}
+	if s.usedEdges[s.getEdgeIndex(vertexX, vertexY, direction)] {
+		return false, 0, 0
+	}
+	return true, vertexX, vertexY
+}
+
+/*
+ * After the outer outline of a region has been walked, any of its cells'
+ * edges that are on an outline but haven't been walked yet must be on
+ * the outline of a hole. Get all the vertices of all those holes.
+ */
+func (s *ShapeExtractor) getRegionHoleVertices(regionCells [][2]int, region int) [][][2]int {
+	allHoles := [][][2]int{}
+
+	for _, nextCell := range regionCells {
+		colX, rowY := split2Int(nextCell)
+		for direction := 0; direction < 4; direction++ {
+			isUnused, vertexX, vertexY := s.getUnusedOutlineEdge(colX, rowY, direction, region)
+			if isUnused {
+				allHoles = append(allHoles, s.outlineRegionVertices(vertexX, vertexY, direction, region))
+			}
+		}
+	}
+
+	return allHoles
+}
+
+/*
+ * Starting from a cell, get all the cells of the same (or a similar) color
+ * that are connected to it and not yet done. Marks them as already done.
+ */
+func (s *ShapeExtractor) getRegionCells(colX, rowY int, color [4]uint8) [][2]int {
+	s.setNeighborEvaluators()
+	s.resetColorSums()
+	s.markCellDone(colX, rowY)
+	s.cellQueue = append(s.cellQueue[:0], [2]int{colX, rowY})
+
+	for index := 0; index < len(s.cellQueue); index++ {
+		nextCol, nextRow := split2Int(s.cellQueue[index])
+		s.addNeighborsToQueue(nextCol, nextRow, color)
+	}
+
+	return s.cellQueue
+}
+
+/*
+ * Get the polygon that covers the region of connected cells with the
+ * same color as the starting cell, with its vertices on pixel corners.
+ * Any areas of other colors inside the region are included as holes.
+ * The region number labels its cells and must be at least 1.
+ */
+func (s *ShapeExtractor) GetRegionPolygon(colX, rowY, region int) (Polygon, error) {
+	if err := s.checkCell(colX, rowY); err != nil {
+		return Polygon{}, err
+	}
+	if region < 1 {
+		return Polygon{}, fmt.Errorf("%w: region should be at least 1, but got %d", ErrOutOfRange, region)
+	}
+	s.ensureRegionBuffers()
+	return s.getRegionPolygon(colX, rowY, region), nil
+}
+
+func (s *ShapeExtractor) getRegionPolygon(colX, rowY, region int) Polygon {
+	color := s.getColor(colX, rowY)
+	regionCells := s.getRegionCells(colX, rowY, color)
+
+	// The outline starts along the top of the region's top left cell
+	// (the first one found going right, then down)
+	topLeftCol, topLeftRow := colX, rowY
+	for _, nextCell := range regionCells {
+		s.regionLabels[nextCell[0]*s.RowCount+nextCell[1]] = region
+		if nextCell[1] < topLeftRow || (nextCell[1] == topLeftRow && nextCell[0] < topLeftCol) {
+			topLeftCol, topLeftRow = split2Int(nextCell)
+		}
+	}
+
+	outlinePoints := getTurningVertices(s.outlineRegionVertices(topLeftCol, topLeftRow, 1, region))
+	allHoles := s.getRegionHoleVertices(regionCells, region)
+	for index, nextHole := range allHoles {
+		allHoles[index] = s.simplifyOutline(getTurningVertices(nextHole))
+	}
+
+	return Polygon{
+		ColorRGBA: s.getRegionColor(color),
+		Points:    s.simplifyOutline(outlinePoints),
+		Holes:     allHoles,
+	}
+}
+
+/*
+ * Goes through the grid, cell by cell, and gets the polygon for every
+ * region of connected cells with the same color.
+ * Passes each polygon to emit as soon as it's found and stops at the
+ * first error emit returns.
+ */
+func (s *ShapeExtractor) processRegions(emit func(Polygon) error) error {
+	s.regionLabels = make([]int, s.ColCount*s.RowCount)
+	s.usedEdges = make([]bool, (s.ColCount+1)*(s.RowCount+1)*4)
+	s.prepareGrid()
+	if s.SharedBorders {
+		return s.processSharedRegions(emit)
+	}
+	if s.canProcessInParallel() {
+		return s.processRegionsInParallel(emit)
+	}
+
+	region := 0
+	for rowIndex := 0; rowIndex < s.RowCount; rowIndex++ {
+		for colIndex := 0; colIndex < s.ColCount; colIndex++ {
+			if s.isDone(colIndex, rowIndex) {
+				continue
+			}
+			region++
+			s.progress.PolygonsFound++
+			if err := emit(s.getRegionPolygon(colIndex, rowIndex, region)); err != nil {
+				return err
+			}
+		}
+		s.rowScanned()
+		if err := s.checkContext(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+/*
+ * Goes through the grid, cell by cell, and gets the polygon for every
+ * region of connected cells with the same color. Vertices are on
+ * pixel corners, so the polygons tile the canvas exactly.
+ */
+func (s *ShapeExtractor) ProcessAllRegions() []Polygon {
+	allPolygons := []Polygon{}
+	s.processRegions(func(nextPolygon Polygon) error {
+		allPolygons = append(allPolygons, nextPolygon)
+		return nil
+	})
+
+	return allPolygons
+}
@@ -0,0 +1,336 @@
+package pixels2svg
+
+import (
+	"testing"
+)
+
+/*
+ * Twice the area of a polygon (shoelace formula), positive when clockwise
+ * on a grid whose rows go down.
+ */
+func getDoubleArea(outlinePoints [][2]int) int {
+	area := 0
+	for index, nextPoint := range outlinePoints {
+		followingPoint := outlinePoints[(index+1)%len(outlinePoints)]
+		area += nextPoint[0]*followingPoint[1] - followingPoint[0]*nextPoint[1]
+	}
+	return area
+}
+
+/*
+ *     0   1   2   3   4
+ * 0 | B | A | A | A | A |
+ * 1 | A | A | A | A | A |
+ * 2 | C | A | A | A | C |
+ * 3 | C | C | A | A | C |
+ */
+func TestProcessAllRegions(t *testing.T) {
+	var s ShapeExtractor
+	s.Init(getColorGrid())
+
+	s.setColor(0, 0, [4]uint8{2, 2, 2, 2})
+	s.setColor(0, 2, [4]uint8{3, 3, 3, 3})
+	s.setColor(0, 3, [4]uint8{3, 3, 3, 3})
+	s.setColor(1, 3, [4]uint8{3, 3, 3, 3})
+	s.setColor(4, 2, [4]uint8{3, 3, 3, 3})
+	s.setColor(4, 3, [4]uint8{3, 3, 3, 3})
+
+	results := s.ProcessAllRegions()
+	expected := []Polygon{
+		{ // B
+			ColorRGBA: [4]uint8{2, 2, 2, 2},
+			Points:    [][2]int{{0, 0}, {1, 0}, {1, 1}, {0, 1}},
+		},
+		{ // A's
+			ColorRGBA: [4]uint8{1, 1, 1, 1},
+			Points: [][2]int{
+				{1, 0},
+				{5, 0},
+				{5, 2},
+				{4, 2},
+				{4, 4},
+				{2, 4},
+				{2, 3},
+				{1, 3},
+				{1, 2},
+				{0, 2},
+				{0, 1},
+				{1, 1},
+			},
+		},
+		{ // C1
+			ColorRGBA: [4]uint8{3, 3, 3, 3},
+			Points:    [][2]int{{0, 2}, {1, 2}, {1, 3}, {2, 3}, {2, 4}, {0, 4}},
+		},
+		{ // C2
+			ColorRGBA: [4]uint8{3, 3, 3, 3},
+			Points:    [][2]int{{4, 2}, {5, 2}, {5, 4}, {4, 4}},
+		},
+	}
+
+	err := comparePolygons(results, expected)
+	if err != "" {
+		t.Errorf("\nPolygons. %s", err)
+	}
+}
+
+/*
+ *     0   1   2
+ * 0 | A | B | B |
+ * 1 | B | A | B |
+ * 2 | B | B | B |
+ *
+ * The A cells only touch at a corner, so they are one region
+ */
+func TestProcessAllRegionsDiagonal(t *testing.T) {
+	var s ShapeExtractor
+	a := [4]uint8{1, 1, 1, 1}
+	b := [4]uint8{2, 2, 2, 2}
+	s.Init([][][4]uint8{
+		{a, b, b},
+		{b, a, b},
+		{b, b, b},
+	})
+
+	results := s.ProcessAllRegions()
+	expected := []Polygon{
+		{
+			ColorRGBA: a,
+			Points: [][2]int{
+				{0, 0}, {1, 0}, {1, 1}, {2, 1}, {2, 2}, {1, 2}, {1, 1}, {0, 1},
+			},
+		},
+		{
+			ColorRGBA: b,
+			Points: [][2]int{
+				{1, 0}, {3, 0}, {3, 3}, {0, 3}, {0, 1}, {1, 1},
+			},
+		},
+	}
+
+	err := comparePolygons(results, expected)
+	if err != "" {
+		t.Errorf("\nPolygons. %s", err)
+	}
+}
+
+/*
+ * Same grid as TestProcessAllRegionsDiagonal, but the A cells only touch
+ * at a corner, so they are separate regions
+ */
+func TestProcessAllRegionsFourConnected(t *testing.T) {
+	var s ShapeExtractor
+	a := [4]uint8{1, 1, 1, 1}
+	b := [4]uint8{2, 2, 2, 2}
+	s.Init([][][4]uint8{
+		{a, b, b},
+		{b, a, b},
+		{b, b, b},
+	})
+	s.Connectivity = FourConnected
+
+	results := s.ProcessAllRegions()
+	expected := []Polygon{
+		{
+			ColorRGBA: a,
+			Points:    [][2]int{{0, 0}, {1, 0}, {1, 1}, {0, 1}},
+		},
+		{
+			ColorRGBA: b,
+			Points: [][2]int{
+				// Around the second A, which it only touches at a corner
+				{1, 0}, {3, 0}, {3, 3}, {0, 3}, {0, 1}, {1, 1}, {1, 2}, {2, 2}, {2, 1}, {1, 1},
+			},
+		},
+		{
+			ColorRGBA: a,
+			Points:    [][2]int{{1, 1}, {2, 1}, {2, 2}, {1, 2}},
+		},
+	}
+
+	err := comparePolygons(results, expected)
+	if err != "" {
+		t.Errorf("\nPolygons. %s", err)
+	}
+}
+
+/*
+ *     0   1
+ * 0 | A | B |
+ * 1 | B | A |
+ *
+ * A is darker, so only the A cells join up
+ */
+func TestProcessAllRegionsDiagonalTieBreak(t *testing.T) {
+	a := [4]uint8{10, 10, 10, 255}
+	b := [4]uint8{200, 200, 200, 255}
+	colorGrid := [][][4]uint8{{a, b}, {b, a}}
+
+	for name, tieBreak := range map[string]DiagonalTieBreak{"DarkerWins": DarkerWins, "LighterWins": LighterWins} {
+		var s ShapeExtractor
+		s.Init(colorGrid)
+		s.DiagonalTieBreak = tieBreak
+
+		results := s.ProcessAllRegions()
+
+		expectedCounts := map[[4]uint8]int{a: 1, b: 2}
+		if tieBreak == LighterWins {
+			expectedCounts = map[[4]uint8]int{a: 2, b: 1}
+		}
+		resultsCounts := map[[4]uint8]int{}
+		for _, nextPolygon := range results {
+			resultsCounts[nextPolygon.ColorRGBA]++
+		}
+		if resultsCounts[a] != expectedCounts[a] || resultsCounts[b] != expectedCounts[b] {
+			t.Errorf("%s. Expected %v regions per color, but got %v", name, expectedCounts, resultsCounts)
+		}
+
+		area := getTotalDoubleArea(results)
+		if area != 8 {
+			t.Errorf("%s. Expected the regions to cover the grid, but got a double area of %d", name, area)
+		}
+	}
+}
+
+/*
+ *  The polygons of all the regions should cover the grid exactly
+ */
+func TestProcessAllRegionsCoversGrid(t *testing.T) {
+	var s ShapeExtractor
+	s.Init(getBigColorGrid())
+
+	allPolygons := s.ProcessAllRegions()
+
+	results := 0
+	for _, nextPolygon := range allPolygons {
+		results += getDoubleArea(nextPolygon.Points)
+		for _, nextHole := range nextPolygon.Holes {
+			results += getDoubleArea(nextHole) // Negative, since holes go counter-clockwise
+		}
+	}
+	expected := 2 * s.ColCount * s.RowCount
+
+	if results != expected {
+		t.Errorf("Expected %d, but got %d", expected, results)
+	}
+}
+
+/*
+ *     0   1   2   3
+ * 0 | A | A | A | A |
+ * 1 | A | B | C | A |
+ * 2 | A | A | A | A |
+ * 3 | B | A | B | A |
+ */
+func TestProcessAllRegionsHoles(t *testing.T) {
+	var s ShapeExtractor
+	a := [4]uint8{1, 1, 1, 1}
+	b := [4]uint8{2, 2, 2, 2}
+	c := [4]uint8{3, 3, 3, 3}
+	s.Init([][][4]uint8{
+		{a, a, a, b},
+		{a, b, a, a},
+		{a, c, a, b},
+		{a, a, a, a},
+	})
+
+	allPolygons := s.ProcessAllRegions()
+
+	results := len(allPolygons)
+	expected := 5
+	if results != expected {
+		t.Errorf("For number of polygons. Expected %d, but got %d", expected, results)
+		return
+	}
+
+	resultsHoles := allPolygons[0].Holes
+	expectedHoles := [][][2]int{
+		{{1, 1}, {1, 2}, {3, 2}, {3, 1}},
+	}
+
+	err := comparePolygonPointsSlices(resultsHoles, expectedHoles)
+	if err != "" {
+		t.Errorf("Holes. %s", err)
+	}
+
+	for _, nextPolygon := range allPolygons[1:] {
+		if len(nextPolygon.Holes) > 0 {
+			t.Errorf("Expected no holes, but got %v", nextPolygon.Holes)
+		}
+	}
+}
+
+func TestGetSVGTextEdgesHole(t *testing.T) {
+	var s ShapeExtractor
+	s.Init(getColorGrid())
+	s.TraceEdges = true
+
+	s.setColor(1, 1, [4]uint8{2, 2, 222, 2})
+
+	results := s.GetSVGText()
+	expected := `<svg xmlns="http://www.w3.org/2000/svg" width="5" height="4" viewBox="0 0 5 4">
+ <g>
+  <path class="#010101" d="M0,0 L5,0 L5,4 L0,4 Z M2,1 L1,1 L1,2 L2,2 Z " fill-rule="evenodd" fill="#010101" />
+  <polygon class="#0202DE" points="1,1 2,1 2,2 1,2 " fill="#0202DE" />
+ </g>
+</svg>`
+
+	if results != expected {
+		t.Errorf("\nExpected \n%s, \nbut got \n%s", expected, results)
+	}
+}
+
+func TestGetSVGTextEdges(t *testing.T) {
+	var s ShapeExtractor
+	s.Init(getColorGrid())
+	s.TraceEdges = true
+
+	s.setColor(0, 0, [4]uint8{2, 2, 222, 2})
+
+	results := s.GetSVGText()
+	expected := `<svg xmlns="http://www.w3.org/2000/svg" width="5" height="4" viewBox="0 0 5 4">
+ <g>
+  <polygon class="#0202DE" points="0,0 1,0 1,1 0,1 " fill="#0202DE" />
+  <polygon class="#010101" points="1,0 5,0 5,4 0,4 0,1 1,1 " fill="#010101" />
+ </g>
+</svg>`
+
+	if results != expected {
+		t.Errorf("\nExpected \n%s, \nbut got \n%s", expected, results)
+	}
+}
+
+/*
+ *     0   1   2
+ * 0 | A | A'| A"|
+ * 1 | A | A'| A"|
+ *
+ * A' is close to A, but A" is only close to A', so it has its own region
+ */
+func TestProcessAllRegionsColorTolerance(t *testing.T) {
+	a := [4]uint8{10, 10, 10, 255}
+	a1 := [4]uint8{14, 10, 10, 255}
+	a2 := [4]uint8{18, 10, 10, 255}
+
+	var s ShapeExtractor
+	s.Init([][][4]uint8{{a, a}, {a1, a1}, {a2, a2}})
+	s.ColorTolerance = 5
+	s.RegionColor = MeanColor
+
+	results := s.ProcessAllRegions()
+	expected := []Polygon{
+		{
+			ColorRGBA: [4]uint8{12, 10, 10, 255},
+			Points:    [][2]int{{0, 0}, {2, 0}, {2, 2}, {0, 2}},
+		},
+		{
+			ColorRGBA: a2,
+			Points:    [][2]int{{2, 0}, {3, 0}, {3, 2}, {2, 2}},
+		},
+	}
+
+	err := comparePolygons(results, expected)
+	if err != "" {
+		t.Errorf("\nPolygons. %s", err)
+	}
+}
@@ -0,0 +1,105 @@
+package pixels2svg
+
+import (
+	"errors"
+	"fmt"
+	"math"
+)
+
+/*
+ * Errors
+ *
+ * Bad input (e.g. from untrusted uploads) gets an error rather than a
+ * panic. The errors wrap one of these, so they can be checked with
+ * errors.Is.
+ */
+
+var (
+	ErrEmptyGrid  = errors.New("pixels2svg: the grid has no cells")
+	ErrRaggedGrid = errors.New("pixels2svg: the columns of the grid aren't all the same length")
+	ErrOutOfRange = errors.New("pixels2svg: out of range")
+	ErrBufferSize = errors.New("pixels2svg: the pixel buffer isn't the right size")
+
+	// A negative width or height for a pixel buffer, or one so big that
+	// its number of bytes doesn't fit in an int
+	ErrInvalidDimensions = errors.New("pixels2svg: invalid dimensions")
+
+	// An edge given to OutlineRegionEdges that doesn't have the region on its
+	// right and another region (or the outside of the grid) on its left
+	ErrNotOnOutline = errors.New("pixels2svg: the edge isn't on the outline of the region")
+
+	// Parallel set along with an option that needs the shapes to be found
+	// one after the other
+	ErrParallelUnsupported = errors.New("pixels2svg: Parallel can't be used")
+)
+
+/*
+ * Check that a grid has at least one cell and that all of its columns
+ * have the same number of rows
+ */
+func checkColorGrid(colorGrid [][][4]uint8) error {
+	if len(colorGrid) == 0 || len(colorGrid[0]) == 0 {
+		return ErrEmptyGrid
+	}
+
+	rowCount := len(colorGrid[0])
+	for colX, nextCol := range colorGrid {
+		if len(nextCol) != rowCount {
+			return fmt.Errorf(
+				"%w: column %d has %d rows, but column 0 has %d",
+				ErrRaggedGrid,
+				colX,
+				len(nextCol),
+				rowCount,
+			)
+		}
+	}
+	return nil
+}
+
+/*
+ * Check the size of a buffer of RGBA values (4 bytes per pixel) before
+ * working out how many bytes it needs, so that a huge size can't make
+ * that wrap around
+ */
+func checkBufferDimensions(width, height int) error {
+	if width < 0 || height < 0 {
+		return fmt.Errorf("%w: the size is %d by %d", ErrInvalidDimensions, width, height)
+	}
+	if width == 0 || height == 0 {
+		return fmt.Errorf("%w: the size is %d by %d", ErrEmptyGrid, width, height)
+	}
+	if height > math.MaxInt/width/4 {
+		return fmt.Errorf("%w: %d by %d pixels is too many", ErrInvalidDimensions, width, height)
+	}
+	return nil
+}
+
+func (s *ShapeExtractor) checkCell(colX, rowY int) error {
+	if colX < 0 || rowY < 0 || colX >= s.ColCount || rowY >= s.RowCount {
+		return fmt.Errorf(
+			"%w: cell %d,%d isn't on the %d by %d grid",
+			ErrOutOfRange,
+			colX,
+			rowY,
+			s.ColCount,
+			s.RowCount,
+		)
+	}
+	return nil
+}
+
+/*
+ * Check a direction, from 0 (North) up to directionCount - 1
+ */
+func checkDirection(direction, directionCount int) error {
+	if direction < 0 || direction >= directionCount {
+		return fmt.Errorf(
+			"%w: direction should be from 0 to %d, but got %d",
+			ErrOutOfRange,
+			directionCount-1,
+			direction,
+		)
+	}
+	return nil
+}
@@ -0,0 +1,104 @@
+package pixels2svg
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestInitEmptyGrid(t *testing.T) {
+	allGrids := [][][][4]uint8{nil, {}, {{}, {}}}
+
+	for index, colorGrid := range allGrids {
+		var s ShapeExtractor
+		err := s.Init(colorGrid)
+		if !errors.Is(err, ErrEmptyGrid) {
+			t.Errorf("For grid %d, expected ErrEmptyGrid, but got %v", index, err)
+		}
+
+		// Nothing left to panic on
+		if allPolygons := s.ProcessAllPolygons(); len(allPolygons) != 0 {
+			t.Errorf("For grid %d, expected no polygons, but got %v", index, allPolygons)
+		}
+		if err := s.WriteSVG(&bytes.Buffer{}); !errors.Is(err, ErrEmptyGrid) {
+			t.Errorf("For grid %d, expected WriteSVG to return ErrEmptyGrid, but got %v", index, err)
+		}
+	}
+}
+
+func TestInitRaggedGrid(t *testing.T) {
+	a := [4]uint8{1, 1, 1, 1}
+	colorGrid := [][][4]uint8{
+		{a, a, a}, // Column 0
+		{a, a},    // Column 1
+		{a, a, a}, // Column 2
+	}
+
+	var s ShapeExtractor
+	err := s.Init(colorGrid)
+	if !errors.Is(err, ErrRaggedGrid) {
+		t.Errorf("Expected ErrRaggedGrid, but got %v", err)
+	}
+	if s.ColCount != 0 || s.RowCount != 0 {
+		t.Errorf("Expected an empty grid, but got %d by %d", s.ColCount, s.RowCount)
+	}
+
+	s.TraceEdges = true
+	if allPolygons, allLines := s.GetAllShapes(); len(allPolygons) != 0 || len(allLines) != 0 {
+		t.Errorf("Expected no shapes, but got %v and %v", allPolygons, allLines)
+	}
+}
+
+func TestOutOfRange(t *testing.T) {
+	var s ShapeExtractor
+	s.Init(getColorGrid())
+	color := [4]uint8{1, 1, 1, 1}
+
+	allErrors := map[string]error{}
+	_, allErrors["GetLine"] = s.GetLine(5, 0)
+	_, allErrors["GetLine negative"] = s.GetLine(0, -1)
+	_, allErrors["OutlinePolygon"] = s.OutlinePolygon(0, 4, 2, color)
+	_, allErrors["OutlinePolygon direction"] = s.OutlinePolygon(0, 0, 8, color)
+	_, allErrors["GetPolygonsFromCell direction"] = s.GetPolygonsFromCell(0, 0, -1, color)
+	_, allErrors["GetRegionPolygon"] = s.GetRegionPolygon(-1, 0, 1)
+	_, allErrors["GetRegionPolygon region"] = s.GetRegionPolygon(0, 0, 0)
+	_, allErrors["OutlineRegionEdges vertex"] = s.OutlineRegionEdges(6, 0, 1, 1)
+	_, allErrors["OutlineRegionEdges direction"] = s.OutlineRegionEdges(0, 0, 4, 1)
+
+	for name, err := range allErrors {
+		if !errors.Is(err, ErrOutOfRange) {
+			t.Errorf("For %s, expected ErrOutOfRange, but got %v", name, err)
+		}
+	}
+
+	_, err := s.OutlineRegionEdges(0, 0, 1, 1)
+	if !errors.Is(err, ErrNotOnOutline) {
+		t.Errorf("For an edge that isn't on the outline, expected ErrNotOnOutline, but got %v", err)
+	}
+}
+
+/*
+ * Starting from any cell of the region gives the same outline
+ * as starting from its top left cell
+ */
+func TestGetRegionPolygonAnyCell(t *testing.T) {
+	var s ShapeExtractor
+	s.Init(getColorGrid())
+
+	results, err := s.GetRegionPolygon(3, 2, 1)
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+		return
+	}
+
+	expected := [][2]int{{0, 0}, {5, 0}, {5, 4}, {0, 4}}
+	errText := comparePolygonPointsSlices([][][2]int{results.Points}, [][][2]int{expected})
+	if errText != "" {
+		t.Error(errText)
+	}
+
+	_, err = s.OutlineRegionEdges(0, 4, 0, 1)
+	if err != nil {
+		t.Errorf("Expected the left side of the region to be on its outline, but got %v", err)
+	}
+}
@@ -0,0 +1,224 @@
+package pixels2svg
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"math/bits"
+	"sync/atomic"
+)
+
+/*
+ * Grid state
+ *
+ * The colors of the grid are kept in one flat slice, column by column
+ * (the same order as regionLabels), rather than a slice for each column.
+ * Which cells are already done is kept in a bitset, one bit per cell.
+ * Both are allocated once, at their full size, and reused when the
+ * extractor is set up again for a grid that isn't bigger.
+ *
+ * Init copies a [][][4]uint8 grid into the flat slice, so the grid passed
+ * to it is never changed. InitFromRGBA and InitFromImage fill it straight
+ * from a buffer or an image, without making a grid first.
+ */
+
+/*
+ * One bit for each cell of the grid, indexed the same as the colors
+ */
+type cellBitset []uint64
+
+/*
+ * Get a bitset with room for cellCount cells, all of them clear,
+ * reusing the given one if it's big enough
+ */
+func makeCellBitset(reuse cellBitset, cellCount int) cellBitset {
+	wordCount := (cellCount + 63) / 64
+	if cap(reuse) < wordCount {
+		return make(cellBitset, wordCount)
+	}
+	reuse = reuse[:wordCount]
+	reuse.clearAll()
+	return reuse
+}
+
+func (b cellBitset) get(index int) bool {
+	return b[index>>6]&(1<<(uint(index)&63)) != 0
+}
+
+func (b cellBitset) set(index int) {
+	b[index>>6] |= 1 << (uint(index) & 63)
+}
+
+func (b cellBitset) clearAll() {
+	for index := range b {
+		b[index] = 0
+	}
+}
+
+func (b cellBitset) count() int {
+	total := 0
+	for _, nextWord := range b {
+		total += bits.OnesCount64(nextWord)
+	}
+	return total
+}
+
+/*
+ * Same as get, but safe while other goroutines call setAtomic
+ */
+func (b cellBitset) getAtomic(index int) bool {
+	return atomic.LoadUint64(&b[index>>6])&(1<<(uint(index)&63)) != 0
+}
+
+/*
+ * Same as set, but safe for goroutines setting other bits of the
+ * same word at the same time
+ */
+func (b cellBitset) setAtomic(index int) {
+	word := &b[index>>6]
+	mask := uint64(1) << (uint(index) & 63)
+	for {
+		oldWord := atomic.LoadUint64(word)
+		if oldWord&mask != 0 || atomic.CompareAndSwapUint64(word, oldWord, oldWord|mask) {
+			return
+		}
+	}
+}
+
+func (s *ShapeExtractor) getCellIndex(colX, rowY int) int {
+	return colX*s.RowCount + rowY
+}
+
+func (s *ShapeExtractor) getColor(colX, rowY int) [4]uint8 {
+	return s.pixels[colX*s.RowCount+rowY]
+}
+
+func (s *ShapeExtractor) setColor(colX, rowY int, color [4]uint8) {
+	s.pixels[colX*s.RowCount+rowY] = color
+}
+
+func (s *ShapeExtractor) isDone(colX, rowY int) bool {
+	return s.doneCells.get(colX*s.RowCount + rowY)
+}
+
+func (s *ShapeExtractor) setDone(colX, rowY int) {
+	s.doneCells.set(colX*s.RowCount + rowY)
+}
+
+/*
+ * Set the size of the grid and get the colors and the bitset ready for
+ * it, with all the cells not done yet. The colors still need filling in.
+ */
+func (s *ShapeExtractor) resizeGrid(colCount, rowCount int) {
+	s.ColCount = colCount
+	s.RowCount = rowCount
+
+	cellCount := colCount * rowCount
+	if cap(s.pixels) < cellCount {
+		s.pixels = make([][4]uint8, cellCount)
+	} else {
+		s.pixels = s.pixels[:cellCount]
+	}
+	s.doneCells = makeCellBitset(s.doneCells, cellCount)
+}
+
+/*
+ * Set up the extractor for a grid of colors ([column][row]).
+ * Returns an error wrapping ErrEmptyGrid or ErrRaggedGrid if the grid
+ * can't be used, or a *LimitError if it's bigger than MaxGridSize, in
+ * which case the extractor is left with an empty grid.
+ * The colors are copied, so the grid can be changed or reused afterwards.
+ */
+func (s *ShapeExtractor) Init(colorGrid [][][4]uint8) error {
+	err := checkColorGrid(colorGrid)
+	if err == nil {
+		err = s.checkGridSize(len(colorGrid), len(colorGrid[0]))
+	}
+	if err != nil {
+		return s.initGrid(err)
+	}
+
+	s.resizeGrid(len(colorGrid), len(colorGrid[0]))
+	for colX, nextCol := range colorGrid {
+		copy(s.pixels[colX*s.RowCount:], nextCol)
+	}
+	return s.initGrid(nil)
+}
+
+/*
+ * Same as Init, but starting with a flat buffer of RGBA values (4 bytes
+ * per pixel, row by row, like the Pix of an image.NRGBA without padding).
+ * Returns an error wrapping ErrEmptyGrid, ErrInvalidDimensions or
+ * ErrBufferSize if the buffer can't be used.
+ */
+func (s *ShapeExtractor) InitFromRGBA(pixels []uint8, width, height int) error {
+	if err := checkBufferDimensions(width, height); err != nil {
+		return s.initGrid(err)
+	}
+	if len(pixels) != width*height*4 {
+		return s.initGrid(fmt.Errorf(
+			"%w: expected %d bytes for %d by %d pixels, but got %d",
+			ErrBufferSize,
+			width*height*4,
+			width,
+			height,
+			len(pixels),
+		))
+	}
+	if err := s.checkGridSize(width, height); err != nil {
+		return s.initGrid(err)
+	}
+
+	s.resizeGrid(width, height)
+	for rowY := 0; rowY < height; rowY++ {
+		rowStart := rowY * width * 4
+		for colX := 0; colX < width; colX++ {
+			start := rowStart + colX*4
+			copy(s.pixels[colX*height+rowY][:], pixels[start:start+4])
+		}
+	}
+	return s.initGrid(nil)
+}
+
+/*
+ * Same as Init, but starting with an image instead of a grid of colors
+ * (see GetColorGridFromImage)
+ */
+func (s *ShapeExtractor) InitFromImage(img image.Image) error {
+	bounds := img.Bounds()
+	if bounds.Empty() {
+		return s.initGrid(ErrEmptyGrid)
+	}
+	if err := s.checkGridSize(bounds.Dx(), bounds.Dy()); err != nil {
+		return s.initGrid(err)
+	}
+
+	s.resizeGrid(bounds.Dx(), bounds.Dy())
+	for colX := 0; colX < s.ColCount; colX++ {
+		for rowY := 0; rowY < s.RowCount; rowY++ {
+			pixel := color.NRGBAModel.Convert(
+				img.At(bounds.Min.X+colX, bounds.Min.Y+rowY),
+			).(color.NRGBA)
+			s.setColor(colX, rowY, [4]uint8{pixel.R, pixel.G, pixel.B, pixel.A})
+		}
+	}
+	return s.initGrid(nil)
+}
+
+/*
+ * Finish setting up the extractor once its colors are filled in.
+ * If there's an error, the extractor is left with an empty grid.
+ */
+func (s *ShapeExtractor) initGrid(err error) error {
+	s.initErr = err
+	if err != nil {
+		s.resizeGrid(0, 0)
+	}
+
+	s.PointsRemoved = 0
+	s.smallRegionsMerged = false
+	s.transparencyChecked = false
+	s.resetProgress(1)
+	s.setNeighborEvaluators()
+	return s.initErr
+}
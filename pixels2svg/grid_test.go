@@ -0,0 +1,189 @@
+package pixels2svg
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"math/bits"
+	"sync"
+	"testing"
+)
+
+/*
+ * The colors the extractor has, as a grid ([column][row])
+ */
+func getExtractorColors(s *ShapeExtractor) [][][4]uint8 {
+	colorGrid := make([][][4]uint8, s.ColCount)
+	for colX := range colorGrid {
+		colorGrid[colX] = make([][4]uint8, s.RowCount)
+		for rowY := range colorGrid[colX] {
+			colorGrid[colX][rowY] = s.getColor(colX, rowY)
+		}
+	}
+	return colorGrid
+}
+
+func TestInitCopiesGrid(t *testing.T) {
+	colorGrid := getBigColorGrid()
+	expected := fmt.Sprint(colorGrid)
+
+	var s ShapeExtractor
+	s.Init(colorGrid)
+	colorGrid[0][0] = [4]uint8{9, 9, 9, 9}
+
+	if results := fmt.Sprint(getExtractorColors(&s)); results != expected {
+		t.Errorf("Expected the colors to stay as they were,\n %s\n but got\n %s", expected, results)
+	}
+}
+
+func TestInitFromRGBA(t *testing.T) {
+	pixels := []uint8{
+		1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, // Row 0
+		13, 14, 15, 16, 17, 18, 19, 20, 21, 22, 23, 24, // Row 1
+	}
+
+	var s ShapeExtractor
+	if err := s.InitFromRGBA(pixels, 3, 2); err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+
+	colorGrid, _ := GetColorGridFromRGBA(pixels, 3, 2)
+	expected := fmt.Sprint(colorGrid)
+	if results := fmt.Sprint(getExtractorColors(&s)); results != expected {
+		t.Errorf("Expected colors\n %s\n but got\n %s", expected, results)
+	}
+}
+
+func TestInitFromRGBABadSize(t *testing.T) {
+	var s ShapeExtractor
+	if err := s.InitFromRGBA(make([]uint8, 20), 3, 2); !errors.Is(err, ErrBufferSize) {
+		t.Errorf("Expected ErrBufferSize, but got %v", err)
+	}
+	if s.ColCount != 0 || s.RowCount != 0 {
+		t.Errorf("Expected an empty grid, but got %d by %d", s.ColCount, s.RowCount)
+	}
+	if err := s.InitFromRGBA([]uint8{}, 0, 2); !errors.Is(err, ErrEmptyGrid) {
+		t.Errorf("Expected ErrEmptyGrid, but got %v", err)
+	}
+}
+
+/*
+ * A size whose number of bytes wraps around to 0 matches an empty buffer,
+ * so it has to be turned down before the length is checked
+ */
+func TestInitFromRGBAInvalidDimensions(t *testing.T) {
+	halfBits := 1 << (bits.UintSize / 2)
+
+	var s ShapeExtractor
+	if err := s.InitFromRGBA(nil, halfBits, halfBits); !errors.Is(err, ErrInvalidDimensions) {
+		t.Errorf("Expected ErrInvalidDimensions, but got %v", err)
+	}
+	if err := s.InitFromRGBA(nil, -1, 2); !errors.Is(err, ErrInvalidDimensions) {
+		t.Errorf("Expected ErrInvalidDimensions, but got %v", err)
+	}
+	if s.ColCount != 0 || s.RowCount != 0 {
+		t.Errorf("Expected an empty grid, but got %d by %d", s.ColCount, s.RowCount)
+	}
+}
+
+func TestInitFromImageSameShapes(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(5, 5, 15, 12))
+	for x := 5; x < 15; x++ {
+		for y := 5; y < 12; y++ {
+			img.SetNRGBA(x, y, color.NRGBA{uint8(x / 3 * 40), uint8(y / 2 * 60), 0, 255})
+		}
+	}
+
+	var s1 ShapeExtractor
+	s1.Init(GetColorGridFromImage(img))
+	expected := s1.GetSVGText()
+
+	var s2 ShapeExtractor
+	if err := s2.InitFromImage(img); err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	if results := s2.GetSVGText(); results != expected {
+		t.Errorf("Expected\n%s\n but got\n%s", expected, results)
+	}
+
+	if err := s2.InitFromImage(image.NewNRGBA(image.Rect(0, 0, 0, 3))); !errors.Is(err, ErrEmptyGrid) {
+		t.Errorf("Expected ErrEmptyGrid, but got %v", err)
+	}
+}
+
+/*
+ * Setting up the same extractor again for a smaller grid reuses its
+ * buffers, with none of the cells done
+ */
+func TestInitAgain(t *testing.T) {
+	var s ShapeExtractor
+	s.Init(getBigColorGrid())
+	s.GetAllShapes()
+
+	s.Init(getColorGrid())
+	if doneCount := s.doneCells.count(); doneCount != 0 {
+		t.Errorf("Expected no cells to be done, but got %d", doneCount)
+	}
+
+	allPolygons, allLines := s.GetAllShapes()
+	if len(allPolygons) != 1 || len(allLines) != 0 {
+		t.Errorf("Expected 1 polygon and 0 lines, but got %v and %v", allPolygons, allLines)
+	}
+}
+
+func TestCellBitsetSetAtomic(t *testing.T) {
+	bitset := makeCellBitset(nil, 200)
+
+	// Every goroutine sets its own bits, which share words with the others
+	var waitGroup sync.WaitGroup
+	for start := 0; start < 4; start++ {
+		waitGroup.Add(1)
+		go func(start int) {
+			defer waitGroup.Done()
+			for index := start; index < 200; index += 4 {
+				bitset.setAtomic(index)
+			}
+		}(start)
+	}
+	waitGroup.Wait()
+
+	if setCount := bitset.count(); setCount != 200 {
+		t.Errorf("Expected 200 bits to be set, but got %d", setCount)
+	}
+	for index := 0; index < 200; index++ {
+		if !bitset.get(index) {
+			t.Errorf("Expected bit %d to be set", index)
+		}
+	}
+}
+
+/*
+ * A grid bigger than MaxGridSize is turned down before any of it is copied
+ */
+func TestInitMaxGridSize(t *testing.T) {
+	allInits := map[string]func(s *ShapeExtractor) error{
+		"Init": func(s *ShapeExtractor) error {
+			return s.Init(getBigColorGrid())
+		},
+		"InitFromRGBA": func(s *ShapeExtractor) error {
+			return s.InitFromRGBA(make([]uint8, 30*20*4), 30, 20)
+		},
+		"InitFromImage": func(s *ShapeExtractor) error {
+			return s.InitFromImage(image.NewNRGBA(image.Rect(0, 0, 30, 20)))
+		},
+	}
+
+	for name, init := range allInits {
+		s := ShapeExtractor{Config: Config{MaxGridSize: 4}}
+		err := init(&s)
+
+		var limitErr *LimitError
+		if !errors.As(err, &limitErr) || limitErr.Limit != "MaxGridSize" {
+			t.Errorf("For %s, expected a LimitError for MaxGridSize, but got %v", name, err)
+		}
+		if s.ColCount != 0 || s.RowCount != 0 || cap(s.pixels) != 0 || cap(s.doneCells) != 0 {
+			t.Errorf("For %s, expected nothing to be allocated, but got a %d by %d grid", name, s.ColCount, s.RowCount)
+		}
+	}
+}
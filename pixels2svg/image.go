@@ -0,0 +1,102 @@
+package pixels2svg
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+)
+
+/*
+ * Convert an image into a grid of colors ([column][row]) for Init.
+ * Works for any kind of image (paletted, RGBA, NRGBA, 16-bit, ...) and
+ * whatever the origin of its bounds, with the top left pixel of the bounds
+ * becoming column 0, row 0.
+ * Colors are not premultiplied by their alpha value.
+ */
+func GetColorGridFromImage(img image.Image) [][][4]uint8 {
+	bounds := img.Bounds()
+	colorGrid := make([][][4]uint8, bounds.Dx())
+
+	for colX := range colorGrid {
+		nextCol := make([][4]uint8, bounds.Dy())
+		for rowY := range nextCol {
+			pixel := color.NRGBAModel.Convert(
+				img.At(bounds.Min.X+colX, bounds.Min.Y+rowY),
+			).(color.NRGBA)
+			nextCol[rowY] = [4]uint8{pixel.R, pixel.G, pixel.B, pixel.A}
+		}
+		colorGrid[colX] = nextCol
+	}
+
+	return colorGrid
+}
+
+/*
+ * Convert a grid of colors given row by row ([row][column]) into
+ * a grid of colors for Init ([column][row]).
+ * Returns an error wrapping ErrEmptyGrid if there are no colors or
+ * ErrRaggedGrid if the rows don't all have the same length.
+ */
+func GetColorGridFromRows(rows [][][4]uint8) ([][][4]uint8, error) {
+	if len(rows) == 0 || len(rows[0]) == 0 {
+		return nil, ErrEmptyGrid
+	}
+
+	colCount := len(rows[0])
+	colorGrid := make([][][4]uint8, colCount)
+	for colX := range colorGrid {
+		colorGrid[colX] = make([][4]uint8, len(rows))
+	}
+
+	for rowY, row := range rows {
+		if len(row) != colCount {
+			return nil, fmt.Errorf(
+				"%w: row %d has %d colors, but row 0 has %d",
+				ErrRaggedGrid,
+				rowY,
+				len(row),
+				colCount,
+			)
+		}
+		for colX, cell := range row {
+			colorGrid[colX][rowY] = cell
+		}
+	}
+
+	return colorGrid, nil
+}
+
+/*
+ * Convert a flat buffer of RGBA values (4 bytes per pixel, row by row,
+ * like the Pix of an image.NRGBA without padding) into a grid of colors
+ * for Init ([column][row]).
+ * Returns an error wrapping ErrEmptyGrid, ErrInvalidDimensions or
+ * ErrBufferSize if the buffer can't be used.
+ */
+func GetColorGridFromRGBA(pixels []uint8, width, height int) ([][][4]uint8, error) {
+	if err := checkBufferDimensions(width, height); err != nil {
+		return nil, err
+	}
+	if len(pixels) != width*height*4 {
+		return nil, fmt.Errorf(
+			"%w: expected %d bytes for %d by %d pixels, but got %d",
+			ErrBufferSize,
+			width*height*4,
+			width,
+			height,
+			len(pixels),
+		)
+	}
+
+	colorGrid := make([][][4]uint8, width)
+	for colX := range colorGrid {
+		nextCol := make([][4]uint8, height)
+		for rowY := range nextCol {
+			start := (rowY*width + colX) * 4
+			copy(nextCol[rowY][:], pixels[start:start+4])
+		}
+		colorGrid[colX] = nextCol
+	}
+
+	return colorGrid, nil
+}
@@ -0,0 +1,186 @@
+package pixels2svg
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+	"math/bits"
+	"testing"
+)
+
+func compareColorGrids(results, expected [][][4]uint8) string {
+	resultsCount := len(results)
+	expectedCount := len(expected)
+
+	if resultsCount != expectedCount {
+		return fmt.Sprintf("\n For number of columns: Expected %d, but got %d", expectedCount, resultsCount)
+	}
+
+	for colX, nextCol := range results {
+		if len(nextCol) != len(expected[colX]) {
+			return fmt.Sprintf(
+				"\n For column %d length: Expected %d, but got %d",
+				colX,
+				len(expected[colX]),
+				len(nextCol),
+			)
+		}
+		for rowY, nextColor := range nextCol {
+			if nextColor != expected[colX][rowY] {
+				return fmt.Sprintf(
+					"\n For column %d, row %d: Expected %v, but got %v",
+					colX,
+					rowY,
+					expected[colX][rowY],
+					nextColor,
+				)
+			}
+		}
+	}
+	return ""
+}
+
+func TestGetColorGridFromImageOffsetBounds(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(10, 20, 13, 22))
+	img.SetNRGBA(10, 20, color.NRGBA{1, 2, 3, 255})
+	img.SetNRGBA(12, 21, color.NRGBA{200, 100, 50, 128})
+
+	results := GetColorGridFromImage(img)
+	expected := [][][4]uint8{
+		{{1, 2, 3, 255}, {0, 0, 0, 0}},
+		{{0, 0, 0, 0}, {0, 0, 0, 0}},
+		{{0, 0, 0, 0}, {200, 100, 50, 128}},
+	}
+
+	err := compareColorGrids(results, expected)
+	if err != "" {
+		t.Errorf("Color grid. %s", err)
+	}
+}
+
+func TestGetColorGridFromImagePaletted(t *testing.T) {
+	palette := color.Palette{
+		color.NRGBA{10, 20, 30, 255},
+		color.NRGBA{40, 50, 60, 255},
+	}
+	img := image.NewPaletted(image.Rect(0, 0, 2, 1), palette)
+	img.SetColorIndex(1, 0, 1)
+
+	results := GetColorGridFromImage(img)
+	expected := [][][4]uint8{
+		{{10, 20, 30, 255}},
+		{{40, 50, 60, 255}},
+	}
+
+	err := compareColorGrids(results, expected)
+	if err != "" {
+		t.Errorf("Color grid. %s", err)
+	}
+}
+
+func TestGetColorGridFromImage16Bit(t *testing.T) {
+	img := image.NewNRGBA64(image.Rect(0, 0, 1, 1))
+	img.SetNRGBA64(0, 0, color.NRGBA64{0xFFFF, 0x8080, 0x0101, 0xFFFF})
+
+	results := GetColorGridFromImage(img)
+	expected := [][][4]uint8{{{255, 128, 1, 255}}}
+
+	err := compareColorGrids(results, expected)
+	if err != "" {
+		t.Errorf("Color grid. %s", err)
+	}
+}
+
+func TestGetColorGridFromRows(t *testing.T) {
+	a := [4]uint8{1, 1, 1, 1}
+	b := [4]uint8{2, 2, 2, 2}
+
+	results, err := GetColorGridFromRows([][][4]uint8{
+		{a, a, b},
+		{b, a, a},
+	})
+	if err != nil {
+		t.Errorf("Unexpected error: %s", err)
+		return
+	}
+	expected := [][][4]uint8{
+		{a, b},
+		{a, a},
+		{b, a},
+	}
+
+	errText := compareColorGrids(results, expected)
+	if errText != "" {
+		t.Errorf("Color grid. %s", errText)
+	}
+}
+
+func TestGetColorGridFromRowsRagged(t *testing.T) {
+	a := [4]uint8{1, 1, 1, 1}
+
+	_, err := GetColorGridFromRows([][][4]uint8{{a, a}, {a}})
+	if !errors.Is(err, ErrRaggedGrid) {
+		t.Errorf("Expected ErrRaggedGrid for rows of different lengths, but got %v", err)
+	}
+}
+
+func TestGetColorGridFromRowsEmpty(t *testing.T) {
+	allRows := [][][][4]uint8{nil, {}, {{}, {}}}
+
+	for index, rows := range allRows {
+		_, err := GetColorGridFromRows(rows)
+		if !errors.Is(err, ErrEmptyGrid) {
+			t.Errorf("For rows %d, expected ErrEmptyGrid, but got %v", index, err)
+		}
+	}
+}
+
+func TestGetColorGridFromRGBA(t *testing.T) {
+	pixels := []uint8{
+		1, 2, 3, 4, 5, 6, 7, 8, // Row 0
+		9, 10, 11, 12, 13, 14, 15, 16, // Row 1
+	}
+
+	results, err := GetColorGridFromRGBA(pixels, 2, 2)
+	if err != nil {
+		t.Errorf("Unexpected error: %s", err)
+		return
+	}
+	expected := [][][4]uint8{
+		{{1, 2, 3, 4}, {9, 10, 11, 12}},
+		{{5, 6, 7, 8}, {13, 14, 15, 16}},
+	}
+
+	errText := compareColorGrids(results, expected)
+	if errText != "" {
+		t.Errorf("Color grid. %s", errText)
+	}
+
+	_, err = GetColorGridFromRGBA(pixels, 3, 2)
+	if !errors.Is(err, ErrBufferSize) {
+		t.Errorf("Expected ErrBufferSize for the wrong number of bytes, but got %v", err)
+	}
+
+	_, err = GetColorGridFromRGBA([]uint8{}, 0, 2)
+	if !errors.Is(err, ErrEmptyGrid) {
+		t.Errorf("Expected ErrEmptyGrid for no pixels, but got %v", err)
+	}
+}
+
+/*
+ * A size whose number of bytes would wrap around to the length of the
+ * buffer is turned down before anything is made for it
+ */
+func TestGetColorGridFromRGBAInvalidDimensions(t *testing.T) {
+	halfBits := 1 << (bits.UintSize / 2)
+	allSizes := [][2]int{{-1, 2}, {2, -1}, {halfBits, halfBits}, {math.MaxInt, 1}}
+
+	for _, size := range allSizes {
+		_, err := GetColorGridFromRGBA(nil, size[0], size[1])
+		if !errors.Is(err, ErrInvalidDimensions) {
+			t.Errorf("For %d by %d, expected ErrInvalidDimensions, but got %v", size[0], size[1], err)
+		}
+	}
+}
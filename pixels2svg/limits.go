@@ -0,0 +1,151 @@
+package pixels2svg
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+/*
+ * Limits
+ *
+ * A pathological image (e.g. a checkerboard of unique colors) can give
+ * millions of shapes. The limits in the Config (MaxGridSize, MaxShapes and
+ * MaxPointsPerPolygon) and a context stop the svg being written, or a
+ * conversion, as soon as one of them is hit. The context is checked for
+ * every row of the grid scanned and every shape found, and, with
+ * Parallel, for every tile and region. Outlines traced through the pixel
+ * centers are also checked against the context and MaxPointsPerPolygon
+ * while they're traced.
+ */
+
+var ErrLimitExceeded = errors.New("pixels2svg: limit exceeded")
+
+/*
+ * The error for going over one of the limits. It wraps ErrLimitExceeded.
+ */
+type LimitError struct {
+	Limit string // The name of the Config field, e.g. "MaxShapes"
+	Max   int    // Its value
+	Value int    // The value that went over it
+}
+
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("%v: %s is %d, but got %d", ErrLimitExceeded, e.Limit, e.Max, e.Value)
+}
+
+func (e *LimitError) Unwrap() error {
+	return ErrLimitExceeded
+}
+
+/*
+ * Get the number of points of a polygon, including the ones of its holes
+ */
+func getPolygonPointCount(polygon Polygon) int {
+	pointCount := len(polygon.Points)
+	for _, nextHole := range polygon.Holes {
+		pointCount += len(nextHole)
+	}
+	return pointCount
+}
+
+/*
+ * Get a *LimitError if a grid of the given size has more cells than
+ * MaxGridSize, before anything is allocated for it
+ */
+func (s *ShapeExtractor) checkGridSize(colCount, rowCount int) error {
+	gridSize := colCount * rowCount
+	if s.MaxGridSize > 0 && gridSize > s.MaxGridSize {
+		return &LimitError{Limit: "MaxGridSize", Max: s.MaxGridSize, Value: gridSize}
+	}
+	return nil
+}
+
+/*
+ * Get the error of the context the shapes are being found with, if it's
+ * done. Safe to call from several goroutines.
+ */
+func (s *ShapeExtractor) checkContext() error {
+	if s.ctx == nil {
+		return nil
+	}
+	return s.ctx.Err()
+}
+
+/*
+ * Check an outline while it's being traced, so that a huge (or runaway)
+ * one stops as soon as it has more points than MaxPointsPerPolygon, or the
+ * context is done, rather than once it's finished. Only while limitShapes
+ * is running, like the other limits.
+ */
+func (s *ShapeExtractor) checkTrace(pointCount int) error {
+	if s.ctx == nil {
+		return nil
+	}
+	if s.MaxPointsPerPolygon > 0 && pointCount > s.MaxPointsPerPolygon {
+		return &LimitError{Limit: "MaxPointsPerPolygon", Max: s.MaxPointsPerPolygon, Value: pointCount}
+	}
+	if pointCount%1024 == 0 {
+		return s.ctx.Err()
+	}
+	return nil
+}
+
+/*
+ * Wrap a shape processor, so that it stops with an error when the context
+ * is done or when one of the limits is hit
+ */
+func (s *ShapeExtractor) limitShapes(ctx context.Context, processShapes shapeProcessor) shapeProcessor {
+	return func(
+		emitPolygon func(Polygon) error,
+		emitLine func(Line) error,
+		emitRectangle func(Rectangle) error,
+	) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		s.ctx = ctx
+		defer func() { s.ctx = nil }()
+		// MaxGridSize can be set after Init
+		if err := s.checkGridSize(s.ColCount, s.RowCount); err != nil {
+			return err
+		}
+
+		shapeCount := 0
+		checkShape := func() error {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			shapeCount++
+			if s.MaxShapes > 0 && shapeCount > s.MaxShapes {
+				return &LimitError{Limit: "MaxShapes", Max: s.MaxShapes, Value: shapeCount}
+			}
+			return nil
+		}
+
+		return processShapes(
+			func(nextPolygon Polygon) error {
+				if err := checkShape(); err != nil {
+					return err
+				}
+				pointCount := getPolygonPointCount(nextPolygon)
+				if s.MaxPointsPerPolygon > 0 && pointCount > s.MaxPointsPerPolygon {
+					return &LimitError{Limit: "MaxPointsPerPolygon", Max: s.MaxPointsPerPolygon, Value: pointCount}
+				}
+				return emitPolygon(nextPolygon)
+			},
+			func(nextLine Line) error {
+				if err := checkShape(); err != nil {
+					return err
+				}
+				return emitLine(nextLine)
+			},
+			func(nextRectangle Rectangle) error {
+				if err := checkShape(); err != nil {
+					return err
+				}
+				return emitRectangle(nextRectangle)
+			},
+		)
+	}
+}
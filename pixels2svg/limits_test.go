@@ -0,0 +1,178 @@
+package pixels2svg
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestConvertLimits(t *testing.T) {
+	colorGrid := getNoisyColorGrid(20, 20, 4)
+	allConfigs := map[string]Config{
+		"MaxGridSize":         {MaxGridSize: 399},
+		"MaxShapes":           {TraceEdges: true, MaxShapes: 10},
+		"MaxPointsPerPolygon": {TraceEdges: true, MaxPointsPerPolygon: 20},
+	}
+
+	for limit, config := range allConfigs {
+		result, err := Convert(colorGrid, config)
+		if !errors.Is(err, ErrLimitExceeded) {
+			t.Errorf("For %s, expected ErrLimitExceeded, but got %v", limit, err)
+			continue
+		}
+		if result != nil {
+			t.Errorf("For %s, expected no result", limit)
+		}
+
+		var limitErr *LimitError
+		if !errors.As(err, &limitErr) || limitErr.Limit != limit {
+			t.Errorf("Expected a LimitError for %s, but got %v", limit, err)
+		}
+	}
+
+	// Just within the limits
+	_, err := Convert(colorGrid, Config{MaxGridSize: 400, MaxShapes: 1000, MaxPointsPerPolygon: 1000})
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
+
+func TestConvertContextDone(t *testing.T) {
+	colorGrid := getNoisyColorGrid(20, 20, 4)
+
+	cancelledCtx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := ConvertContext(cancelledCtx, colorGrid, Config{})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled, but got %v", err)
+	}
+
+	expiredCtx, cancel := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer cancel()
+	_, err = ConvertContext(expiredCtx, colorGrid, Config{TraceEdges: true})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected context.DeadlineExceeded, but got %v", err)
+	}
+}
+
+/*
+ * Cancelling while the shapes are being written stops at the next shape
+ */
+func TestWriteSVGContextCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	classCount := 0
+	s, _ := NewShapeExtractor(getNoisyColorGrid(20, 20, 4), Config{
+		TraceEdges:    true,
+		UseStyleSheet: true,
+		ClassName: func(index int, colorRGBA [4]uint8) string {
+			classCount++
+			cancel()
+			return fmt.Sprintf("c%d", index)
+		},
+	})
+
+	err := s.WriteSVGContext(ctx, &bytes.Buffer{})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled, but got %v", err)
+	}
+	if classCount != 1 {
+		t.Errorf("Expected to stop after the first shape, but named %d classes", classCount)
+	}
+}
+
+/*
+ * Cancelling while the grid is being scanned stops at the next row, even
+ * when no more shapes are found
+ */
+func TestConvertContextCancelledWhileScanning(t *testing.T) {
+	colorGrid := make([][][4]uint8, 40)
+	for colX := range colorGrid {
+		colorGrid[colX] = make([][4]uint8, 40)
+		for rowY := range colorGrid[colX] {
+			colorGrid[colX][rowY] = [4]uint8{200, 0, 0, 255}
+		}
+	}
+	allConfigs := map[string]Config{
+		"Centers":         {},
+		"TraceEdges":      {TraceEdges: true},
+		"SharedBorders":   {TraceEdges: true, SharedBorders: true},
+		"Parallel":        {TraceEdges: true, Parallel: true, TileSize: 8},
+		"ParallelCenters": {Parallel: true, TileSize: 8},
+		"Rectangles":      {Strategy: Rectangles},
+		"MinRegionSize":   {MinRegionSize: 4},
+	}
+
+	for name, config := range allConfigs {
+		ctx, cancel := context.WithCancel(context.Background())
+		rowsScanned := 0
+		config.OnProgress = func(progress Progress) {
+			rowsScanned = progress.RowsScanned
+			if progress.RowsScanned == 1 {
+				cancel()
+			}
+		}
+
+		_, err := ConvertContext(ctx, colorGrid, config)
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("For %s, expected context.Canceled, but got %v", name, err)
+		}
+		if rowsScanned != 1 {
+			t.Errorf("For %s, expected to stop after 1 row, but scanned %d", name, rowsScanned)
+		}
+		cancel()
+	}
+}
+
+/*
+ * A big outline traced through the pixel centers stops as soon as it has
+ * too many points, even though it would be reduced to a few
+ */
+func TestConvertMaxPointsWhileTracing(t *testing.T) {
+	_, err := Convert(getUniformColorGrid(300, 300), Config{MaxPointsPerPolygon: 500})
+
+	var limitErr *LimitError
+	if !errors.As(err, &limitErr) || limitErr.Limit != "MaxPointsPerPolygon" {
+		t.Fatalf("Expected a LimitError for MaxPointsPerPolygon, but got %v", err)
+	}
+	if limitErr.Value != 501 {
+		t.Errorf("Expected to stop at 501 points, but got %d", limitErr.Value)
+	}
+}
+
+/*
+ * Cancelling while one big outline is traced stops it part way
+ */
+func TestConvertContextCancelledWhileTracing(t *testing.T) {
+	// Two close colors in stripes, so that they're all one polygon
+	colorGrid := getUniformColorGrid(300, 300)
+	for colX := 0; colX < 300; colX += 2 {
+		for rowY := range colorGrid[colX] {
+			colorGrid[colX][rowY] = [4]uint8{11, 20, 30, 255}
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	checkCount := 0
+	config := Config{
+		ColorTolerance: 5,
+		ColorDistance: func(color1, color2 [4]uint8) float64 {
+			checkCount++
+			cancel()
+			return EuclideanRGBDistance(color1, color2)
+		},
+	}
+
+	_, err := ConvertContext(ctx, colorGrid, config)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled, but got %v", err)
+	}
+	if checkCount > 8*1024 {
+		t.Errorf("Expected to stop part way through the outline, but the colors were checked %d times", checkCount)
+	}
+}
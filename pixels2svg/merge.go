@@ -0,0 +1,227 @@
+package pixels2svg
+
+import (
+	"bufio"
+	"fmt"
+	"math"
+	"strings"
+)
+
+/*
+ * Merged output
+ *
+ * With MergeByColor, all the shapes of one color are written as a single
+ * <path>, with a subpath for each outline and each rectangle. The path data
+ * uses relative commands (h and v for straight runs) and leaves out
+ * anything that isn't needed, such as leading zeros, repeated commands and
+ * spaces before negative numbers. The color is then only written once.
+ *
+ * Since the paths can only be written once every shape is known, the
+ * shapes are kept in memory rather than streamed. And since the shapes are
+ * no longer written in the order they were found, they mustn't overlap,
+ * so the outlines are traced along the pixel edges (see TraceEdges).
+ */
+
+/*
+ * Builds the "d" attribute of a path out of relative commands
+ */
+type pathBuilder struct {
+	data        strings.Builder
+	lastCommand byte
+	current     [2]float64 // Where the pen is
+	subpathAt   [2]float64 // Where the current subpath started
+	hasStarted  bool
+}
+
+/*
+ * Format a number as briefly as possible, with no more than three
+ * decimals, e.g. 2, .5 or -1.333
+ */
+func formatShortNumber(number float64) string {
+	text := formatNumber(number)
+	switch {
+	case text == "-0":
+		return "0"
+	case strings.HasPrefix(text, "0."):
+		return text[1:]
+	case strings.HasPrefix(text, "-0."):
+		return "-" + text[2:]
+	}
+	return text
+}
+
+/*
+ * Add a command and its numbers. The command letter is left out when
+ * it's the same as the previous one, and a space is only added between
+ * numbers that would otherwise run together.
+ */
+func (p *pathBuilder) writeCommand(command byte, allNumbers ...float64) {
+	needsSeparator := true
+	if command != p.lastCommand || command == 'm' || command == 'z' {
+		p.data.WriteByte(command)
+		needsSeparator = false
+	}
+	p.lastCommand = command
+
+	for _, nextNumber := range allNumbers {
+		text := formatShortNumber(nextNumber)
+		if needsSeparator && text[0] != '-' {
+			p.data.WriteByte(' ')
+		}
+		p.data.WriteString(text)
+		needsSeparator = true
+	}
+}
+
+/*
+ * Round a point the same way as it's written, so that the relative
+ * moves don't drift away from the absolute coordinates
+ */
+func roundPoint(point [2]float64) [2]float64 {
+	return [2]float64{math.Round(point[0]*1000) / 1000, math.Round(point[1]*1000) / 1000}
+}
+
+func (p *pathBuilder) moveTo(point [2]float64) {
+	point = roundPoint(point)
+	if p.hasStarted {
+		p.writeCommand('m', point[0]-p.current[0], point[1]-p.current[1])
+	} else {
+		p.writeCommand('M', point[0], point[1])
+		p.hasStarted = true
+	}
+	p.current = point
+	p.subpathAt = point
+}
+
+func (p *pathBuilder) lineTo(point [2]float64) {
+	point = roundPoint(point)
+	deltaX := point[0] - p.current[0]
+	deltaY := point[1] - p.current[1]
+	switch {
+	case deltaY == 0:
+		p.writeCommand('h', deltaX)
+	case deltaX == 0:
+		p.writeCommand('v', deltaY)
+	default:
+		p.writeCommand('l', deltaX, deltaY)
+	}
+	p.current = point
+}
+
+func (p *pathBuilder) curveTo(control1, control2, end [2]float64) {
+	control1 = roundPoint(control1)
+	control2 = roundPoint(control2)
+	end = roundPoint(end)
+	p.writeCommand(
+		'c',
+		control1[0]-p.current[0],
+		control1[1]-p.current[1],
+		control2[0]-p.current[0],
+		control2[1]-p.current[1],
+		end[0]-p.current[0],
+		end[1]-p.current[1],
+	)
+	p.current = end
+}
+
+func (p *pathBuilder) closePath() {
+	p.writeCommand('z')
+	p.current = p.subpathAt
+}
+
+/*
+ * Add a closed outline, straight from point to point
+ */
+func (p *pathBuilder) addOutline(outlinePoints [][2]int) {
+	for index, nextPoint := range outlinePoints {
+		point := toFloatPoint(nextPoint)
+		if index == 0 {
+			p.moveTo(point)
+		} else {
+			p.lineTo(point)
+		}
+	}
+	p.closePath()
+}
+
+/*
+ * Add a closed outline made of curves
+ */
+func (p *pathBuilder) addCurves(allCurves []BezierSegment) {
+	if len(allCurves) == 0 {
+		return
+	}
+	p.moveTo(allCurves[0].Start)
+	for _, nextCurve := range allCurves {
+		p.curveTo(nextCurve.Control1, nextCurve.Control2, nextCurve.End)
+	}
+	p.closePath()
+}
+
+func (p *pathBuilder) addRectangle(rectangle Rectangle) {
+	p.moveTo([2]float64{float64(rectangle.ColX), float64(rectangle.RowY)})
+	p.lineTo([2]float64{p.current[0] + float64(rectangle.Width), p.current[1]})
+	p.lineTo([2]float64{p.current[0], p.current[1] + float64(rectangle.Height)})
+	p.lineTo([2]float64{p.current[0] - float64(rectangle.Width), p.current[1]})
+	p.closePath()
+}
+
+/*
+ * Write all the shapes, merged into one path per color,
+ * in the order in which the colors are first found
+ */
+func (s *ShapeExtractor) writeMergedShapes(svgWriter *bufio.Writer, processShapes shapeProcessor) error {
+	allColors := [][4]uint8{}
+	colorPaths := map[[4]uint8]*pathBuilder{}
+
+	getColorPath := func(colorRGBA [4]uint8) *pathBuilder {
+		builder, found := colorPaths[colorRGBA]
+		if !found {
+			builder = &pathBuilder{}
+			colorPaths[colorRGBA] = builder
+			allColors = append(allColors, colorRGBA)
+		}
+		return builder
+	}
+
+	err := processShapes(
+		func(nextPolygon Polygon) error {
+			builder := getColorPath(nextPolygon.ColorRGBA)
+			allOutlines := append([][][2]int{nextPolygon.Points}, nextPolygon.Holes...)
+			for _, nextOutline := range allOutlines {
+				if s.Smooth {
+					builder.addCurves(s.getOutlineCurves(nextOutline))
+				} else {
+					builder.addOutline(nextOutline)
+				}
+			}
+			return nil
+		},
+		func(nextLine Line) error {
+			builder := getColorPath(nextLine.ColorRGBA)
+			for _, nextRectangle := range getLineRectangles(nextLine) {
+				builder.addRectangle(nextRectangle)
+			}
+			return nil
+		},
+		func(nextRectangle Rectangle) error {
+			getColorPath(nextRectangle.ColorRGBA).addRectangle(nextRectangle)
+			return nil
+		},
+	)
+	if err != nil {
+		return err
+	}
+
+	s.setPhase(PhaseRendering)
+	for _, nextColor := range allColors {
+		_, err = fmt.Fprintf(
+			svgWriter,
+			"  <path class=\"%s\" d=\"%s\" fill-rule=\"evenodd\"%s />\n",
+			s.getClassName(nextColor),
+			colorPaths[nextColor].data.String(),
+			s.getPaintAttributes(nextColor, false),
+		)
+	}
+	return err
+}
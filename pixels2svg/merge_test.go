@@ -0,0 +1,114 @@
+package pixels2svg
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestFormatShortNumber(t *testing.T) {
+	allTests := map[float64]string{
+		2:       "2",
+		0.5:     ".5",
+		-0.5:    "-.5",
+		-1.3333: "-1.333",
+		-0.0001: "0",
+		12.25:   "12.25",
+	}
+
+	for number, expected := range allTests {
+		results := formatShortNumber(number)
+		if results != expected {
+			t.Errorf("For %v, expected %s, but got %s", number, expected, results)
+		}
+	}
+}
+
+func TestPathBuilder(t *testing.T) {
+	var builder pathBuilder
+	builder.addOutline([][2]int{{1, 1}, {4, 1}, {4, 3}, {2, 5}, {1, 3}})
+	builder.addRectangle(Rectangle{ColX: 0, RowY: 6, Width: 2, Height: 1})
+	builder.addOutline([][2]int{{6, 0}, {7, 1}, {8, 3}, {6, 3}})
+
+	results := builder.data.String()
+	expected := "M1 1h3v2l-2 2-1-2z" + "m-1 5h2v1h-2z" + "m6-6l1 1 1 2h-2z"
+
+	if results != expected {
+		t.Errorf("Expected path data\n%s\nbut got\n%s", expected, results)
+	}
+}
+
+/*
+ *    0  1  2
+ *  0 a  a  b
+ *  1 b  a  a
+ *  2 b  b  a
+ */
+func TestGetSVGTextMergeByColor(t *testing.T) {
+	a := [4]uint8{1, 1, 1, 255}
+	b := [4]uint8{2, 2, 2, 255}
+	colorGrid := [][][4]uint8{
+		{a, b, b}, // Column 0
+		{a, a, b}, // Column 1
+		{b, a, a}, // Column 2
+	}
+
+	var s ShapeExtractor
+	s.Init(colorGrid)
+	s.TraceEdges = true
+	s.MergeByColor = true
+
+	results := s.GetSVGText()
+	expected := `<svg xmlns="http://www.w3.org/2000/svg" width="3" height="3" viewBox="0 0 3 3">
+ <g>
+  <path class="#010101" d="M0 0h2v1h1v2h-1v-1h-1v-1h-1z" fill-rule="evenodd" fill="#010101" />
+  <path class="#020202" d="M2 0h1v1h-1zm-2 1h1v1h1v1h-2z" fill-rule="evenodd" fill="#020202" />
+ </g>
+</svg>`
+
+	if results != expected {
+		t.Errorf("Expected svg\n%s\nbut got\n%s", expected, results)
+	}
+}
+
+func TestGetSVGTextMergeByColorBig(t *testing.T) {
+	var s ShapeExtractor
+	s.Init(getBigColorGrid())
+	s.TraceEdges = true
+	unmerged := s.GetSVGText()
+
+	s.Init(getBigColorGrid())
+	s.TraceEdges = true
+	s.MergeByColor = true
+	results := s.GetSVGText()
+
+	if len(results) >= len(unmerged) {
+		t.Errorf("Expected the merged svg to be smaller than %d characters, but got %d", len(unmerged), len(results))
+	}
+
+	for _, hexColor := range []string{"#EB0000", "#EBEB00", "#0000DC", "#00B43C"} {
+		pathCount := strings.Count(results, `<path class="`+hexColor+`"`)
+		if pathCount != 1 {
+			t.Errorf("Expected one path for %s, but got %d", hexColor, pathCount)
+		}
+	}
+}
+
+/*
+ * Without TraceEdges, the outlines are traced along the pixel edges anyway
+ */
+func TestGetSVGTextMergeByColorCenters(t *testing.T) {
+	var s ShapeExtractor
+	s.Init(getColorGrid())
+	s.MergeByColor = true
+
+	results := s.GetSVGText()
+	expected := `<svg xmlns="http://www.w3.org/2000/svg" width="5" height="4" viewBox="0 0 5 4">
+ <g>
+  <path class="#010101" d="M0 0h5v4h-5z" fill-rule="evenodd" fill="#010101" />
+ </g>
+</svg>`
+
+	if results != expected {
+		t.Errorf("Expected svg\n%s\nbut got\n%s", expected, results)
+	}
+}
@@ -0,0 +1,511 @@
+package pixels2svg
+
+import (
+	"fmt"
+	"runtime"
+	"sync"
+)
+
+/*
+ * Parallel regions
+ *
+ * Finding the regions of a big grid one after the other is slow. With
+ * Parallel, it's done in three steps:
+ *  1. The grid is split into tiles and the cells of each tile are joined up
+ *     into regions (with a union-find), several tiles at a time. Then the
+ *     regions that cross the sides of the tiles are joined up.
+ *  2. The regions are numbered in the order their top left cells come,
+ *     going right, then down, the same as processRegions numbers them.
+ *  3. The polygons for the regions are found, several at a time. Each
+ *     region only labels and walks its own cells and edges.
+ * The polygons are then passed on in the order of their regions, so the
+ * shapes are exactly the same as processRegions gives.
+ *
+ * When tracing through the pixel centers, the polygons and lines of a
+ * region only depend on its own cells, so the regions are labeled the
+ * same way and each region's cells are then gone through on a copy of the
+ * extractor (see getWorkerCopy), several regions at a time. The shapes
+ * are passed on in the order of the cells they were found from, the same
+ * as processPolygons and processLines give.
+ *
+ * With ColorTolerance, a region depends on the cell it's found from, and
+ * with SharedBorders, on the regions found before it, so Parallel can't
+ * be used with either of them, or with the Rectangles strategy.
+ */
+
+const DefaultTileSize = 256
+
+/*
+ * Can the regions be found in parallel and give the same shapes.
+ * (processRegions has already handled SharedBorders.)
+ */
+func (s *ShapeExtractor) canProcessInParallel() bool {
+	return s.Parallel && s.ColorTolerance <= 0
+}
+
+/*
+ * Get an error wrapping ErrParallelUnsupported if Parallel is set along
+ * with options that need the shapes to be found one after the other,
+ * rather than quietly finding them that way
+ */
+func (s *ShapeExtractor) checkParallel() error {
+	reason := ""
+	switch {
+	case !s.Parallel:
+	case s.Strategy == Rectangles:
+		reason = "the Rectangles strategy"
+	case s.ColorTolerance > 0:
+		reason = "ColorTolerance"
+	case s.SharedBorders && s.isTracingEdges():
+		reason = "SharedBorders"
+	}
+	if reason == "" {
+		return nil
+	}
+	return fmt.Errorf("%w with %s", ErrParallelUnsupported, reason)
+}
+
+/*
+ * Run work for each index from 0 to count - 1 on as many goroutines
+ * as GOMAXPROCS
+ */
+func runOnWorkers(count int, work func(index int)) {
+	workerCount := runtime.GOMAXPROCS(0)
+	if workerCount > count {
+		workerCount = count
+	}
+
+	indexes := make(chan int)
+	var waitGroup sync.WaitGroup
+	for worker := 0; worker < workerCount; worker++ {
+		waitGroup.Add(1)
+		go func() {
+			defer waitGroup.Done()
+			for index := range indexes {
+				work(index)
+			}
+		}()
+	}
+
+	for index := 0; index < count; index++ {
+		indexes <- index
+	}
+	close(indexes)
+	waitGroup.Wait()
+}
+
+/*
+ * The regions' union-find, with an entry for each cell
+ * (at col * RowCount + row)
+ */
+type cellUnionFind []int32
+
+func (u cellUnionFind) find(cellIndex int32) int32 {
+	for u[cellIndex] != cellIndex {
+		u[cellIndex] = u[u[cellIndex]] // Halve the path on the way
+		cellIndex = u[cellIndex]
+	}
+	return cellIndex
+}
+
+func (u cellUnionFind) union(cellIndex1, cellIndex2 int32) {
+	root1 := u.find(cellIndex1)
+	root2 := u.find(cellIndex2)
+	switch {
+	case root1 < root2:
+		u[root2] = root1
+	case root2 < root1:
+		u[root1] = root2
+	}
+}
+
+// The neighbors already seen when going right, then down:
+// West, North-West, North and North-East
+var earlierNeighborOffsets = [4][2]int{{-1, 0}, {-1, -1}, {0, -1}, {1, -1}}
+
+/*
+ * Are two neighboring cells part of the same region
+ */
+func (s *ShapeExtractor) areCellsJoined(colX1, rowY1, colX2, rowY2 int) bool {
+	if s.isDone(colX1, rowY1) || s.isDone(colX2, rowY2) {
+		return false
+	}
+	if s.getColor(colX1, rowY1) != s.getColor(colX2, rowY2) {
+		return false
+	}
+	if colX1 != colX2 && rowY1 != rowY2 {
+		return s.areDiagonalCellsJoined(colX1, rowY1, colX2, rowY2)
+	}
+	return true
+}
+
+/*
+ * Join up the cells of a tile with their earlier neighbors. If isInTile is
+ * true, only with the ones in the same tile, otherwise only with the ones
+ * in other tiles.
+ */
+func (s *ShapeExtractor) joinTileCells(
+	regions cellUnionFind,
+	startCol, startRow, tileSize int,
+	isInTile bool,
+) {
+	endCol := startCol + tileSize
+	if endCol > s.ColCount {
+		endCol = s.ColCount
+	}
+	endRow := startRow + tileSize
+	if endRow > s.RowCount {
+		endRow = s.RowCount
+	}
+
+	for rowY := startRow; rowY < endRow; rowY++ {
+		for colX := startCol; colX < endCol; colX++ {
+			isOnSide := rowY == startRow || colX == startCol || colX == endCol-1
+			if !isInTile && !isOnSide {
+				continue // Only the cells on the sides have neighbors in other tiles
+			}
+			for _, offset := range earlierNeighborOffsets {
+				neighborCol := colX + offset[0]
+				neighborRow := rowY + offset[1]
+				if neighborCol < 0 || neighborRow < 0 || neighborCol >= s.ColCount {
+					continue
+				}
+				isNeighborInTile := neighborCol >= startCol && neighborCol < endCol && neighborRow >= startRow
+				if isNeighborInTile != isInTile {
+					continue
+				}
+				if s.areCellsJoined(colX, rowY, neighborCol, neighborRow) {
+					regions.union(int32(colX*s.RowCount+rowY), int32(neighborCol*s.RowCount+neighborRow))
+				}
+			}
+		}
+	}
+}
+
+/*
+ * Label every cell with its region, numbered the same as processRegions
+ * would, and get the top left cell of each region. Stops with the error
+ * of the context if it's done.
+ */
+func (s *ShapeExtractor) labelRegionsInParallel() ([][2]int, error) {
+	tileSize := s.TileSize
+	if tileSize <= 0 {
+		tileSize = DefaultTileSize
+	}
+	tileCols := (s.ColCount + tileSize - 1) / tileSize
+	tileRows := (s.RowCount + tileSize - 1) / tileSize
+
+	regions := make(cellUnionFind, s.ColCount*s.RowCount)
+	for cellIndex := range regions {
+		regions[cellIndex] = int32(cellIndex)
+	}
+
+	// Each tile only changes the entries of its own cells
+	runOnWorkers(tileCols*tileRows, func(tileIndex int) {
+		if s.checkContext() != nil {
+			return
+		}
+		startCol := (tileIndex % tileCols) * tileSize
+		startRow := (tileIndex / tileCols) * tileSize
+		s.joinTileCells(regions, startCol, startRow, tileSize, true)
+	})
+	for tileIndex := 0; tileIndex < tileCols*tileRows; tileIndex++ {
+		if err := s.checkContext(); err != nil {
+			return nil, err
+		}
+		startCol := (tileIndex % tileCols) * tileSize
+		startRow := (tileIndex / tileCols) * tileSize
+		s.joinTileCells(regions, startCol, startRow, tileSize, false)
+	}
+
+	rootRegions := make([]int, len(regions))
+	topLeftCells := [][2]int{}
+	for rowY := 0; rowY < s.RowCount; rowY++ {
+		for colX := 0; colX < s.ColCount; colX++ {
+			if s.isDone(colX, rowY) {
+				continue
+			}
+			cellIndex := colX*s.RowCount + rowY
+			root := regions.find(int32(cellIndex))
+			if rootRegions[root] == 0 {
+				topLeftCells = append(topLeftCells, [2]int{colX, rowY})
+				rootRegions[root] = len(topLeftCells)
+			}
+			s.regionLabels[cellIndex] = rootRegions[root]
+		}
+		s.rowScanned()
+		if err := s.checkContext(); err != nil {
+			return nil, err
+		}
+	}
+
+	return topLeftCells, nil
+}
+
+/*
+ * Get the cells of a labeled region in the same order as getRegionCells
+ * would, marking them as already done. Uses its own queue, so that
+ * several regions can be done at the same time. Neighboring regions can
+ * have cells in the same word of the bitset, so it's changed atomically.
+ */
+func (s *ShapeExtractor) getLabeledRegionCells(colX, rowY, region int) [][2]int {
+	s.doneCells.setAtomic(s.getCellIndex(colX, rowY))
+	cellQueue := [][2]int{{colX, rowY}}
+
+	for index := 0; index < len(cellQueue); index++ {
+		cellCol, cellRow := split2Int(cellQueue[index])
+		for direction := 0; direction < 8; direction++ {
+			nextCol, nextRow := s.getCellInDirection(cellCol, cellRow, direction)
+			if !s.isCellInRegion(nextCol, nextRow, region) || s.doneCells.getAtomic(s.getCellIndex(nextCol, nextRow)) {
+				continue
+			}
+			if direction%2 == 1 && !s.areDiagonalCellsJoined(cellCol, cellRow, nextCol, nextRow) {
+				continue
+			}
+			s.doneCells.setAtomic(s.getCellIndex(nextCol, nextRow))
+			cellQueue = append(cellQueue, [2]int{nextCol, nextRow})
+		}
+	}
+
+	return cellQueue
+}
+
+/*
+ * Same as processRegions, but finding the regions in parallel
+ * (see canProcessInParallel). The polygons are only passed on once
+ * they have all been found.
+ */
+func (s *ShapeExtractor) processRegionsInParallel(emit func(Polygon) error) error {
+	topLeftCells, err := s.labelRegionsInParallel()
+	if err != nil {
+		return err
+	}
+
+	// Not simplified yet, since that adds up PointsRemoved
+	allPolygons := make([]Polygon, len(topLeftCells))
+	runOnWorkers(len(topLeftCells), func(regionIndex int) {
+		if s.checkContext() != nil {
+			return
+		}
+		region := regionIndex + 1
+		colX, rowY := split2Int(topLeftCells[regionIndex])
+		regionCells := s.getLabeledRegionCells(colX, rowY, region)
+
+		outlinePoints := getTurningVertices(s.outlineRegionVertices(colX, rowY, 1, region))
+		allHoles := s.getRegionHoleVertices(regionCells, region)
+		for index, nextHole := range allHoles {
+			allHoles[index] = getTurningVertices(nextHole)
+		}
+
+		// All the cells of a region have exactly the same color
+		allPolygons[regionIndex] = Polygon{
+			ColorRGBA: s.getColor(colX, rowY),
+			Points:    outlinePoints,
+			Holes:     allHoles,
+		}
+	})
+	if err := s.checkContext(); err != nil {
+		return err
+	}
+
+	for _, nextPolygon := range allPolygons {
+		for index, nextHole := range nextPolygon.Holes {
+			nextPolygon.Holes[index] = s.simplifyOutline(nextHole)
+		}
+		nextPolygon.Points = s.simplifyOutline(nextPolygon.Points)
+		s.progress.PolygonsFound++
+		if err := emit(nextPolygon); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+/*
+ * Get a copy of the extractor for a worker, sharing the colors, but with
+ * its own done cells and everything else that changes while the shapes
+ * are found. It doesn't report progress, since only the goroutine doing
+ * the conversion does that.
+ */
+func (s *ShapeExtractor) getWorkerCopy() *ShapeExtractor {
+	worker := *s
+	worker.doneCells = append(cellBitset(nil), s.doneCells...)
+	worker.cellQueue = nil
+	worker.regionLabels = nil
+	worker.usedEdges = nil
+	worker.sharedArcs = nil
+	worker.styleSheetColors = nil
+	worker.classNames = nil
+	worker.PointsRemoved = 0
+	worker.OnProgress = nil
+
+	// The evaluators are bound to the extractor they were set up for
+	worker.neighborEvaluators = [8]evaluatorFunc{}
+	worker.setNeighborEvaluators()
+	return &worker
+}
+
+/*
+ * Get the cells of every labeled region (see labelRegionsInParallel),
+ * going right, then down, one region after the other, along with where
+ * each region's cells start
+ */
+func (s *ShapeExtractor) getCellsByRegion(regionCount int) ([][2]int, []int) {
+	regionCellStarts := make([]int, regionCount+1)
+	for _, region := range s.regionLabels {
+		if region > 0 {
+			regionCellStarts[region]++
+		}
+	}
+	for index := 1; index <= regionCount; index++ {
+		regionCellStarts[index] += regionCellStarts[index-1]
+	}
+
+	allRegionCells := make([][2]int, regionCellStarts[regionCount])
+	nextIndexes := append([]int{}, regionCellStarts[:regionCount]...)
+	for rowY := 0; rowY < s.RowCount; rowY++ {
+		for colX := 0; colX < s.ColCount; colX++ {
+			region := s.regionLabels[colX*s.RowCount+rowY]
+			if region > 0 {
+				allRegionCells[nextIndexes[region-1]] = [2]int{colX, rowY}
+				nextIndexes[region-1]++
+			}
+		}
+	}
+
+	return allRegionCells, regionCellStarts
+}
+
+/*
+ * A polygon or line found by a worker, with the order of the cell it was
+ * found from (going right, then down)
+ */
+type cellShape struct {
+	cellOrder int
+	polygon   Polygon
+	line      Line
+}
+
+/*
+ * Label the regions that aren't done yet and get the shapes of each of
+ * them with findRegionShapes, given its cells in order, on a copy of the
+ * extractor. Several regions are done at a time. Then passes all the
+ * shapes to emit in the order of the cells they were found from, once
+ * the cells the workers have done are marked as done.
+ */
+func (s *ShapeExtractor) processCentersInParallel(
+	findRegionShapes func(worker *ShapeExtractor, regionCells [][2]int) ([]cellShape, error),
+	emit func(cellShape) error,
+) error {
+	s.regionLabels = make([]int, s.ColCount*s.RowCount)
+	topLeftCells, err := s.labelRegionsInParallel()
+	if err != nil {
+		return err
+	}
+	regionCount := len(topLeftCells)
+	allRegionCells, regionCellStarts := s.getCellsByRegion(regionCount)
+
+	// One copy for each goroutine runOnWorkers starts
+	workerCount := runtime.GOMAXPROCS(0)
+	if workerCount > regionCount {
+		workerCount = regionCount
+	}
+	workers := make(chan *ShapeExtractor, workerCount)
+	for index := 0; index < workerCount; index++ {
+		workers <- s.getWorkerCopy()
+	}
+
+	regionShapes := make([][]cellShape, regionCount)
+	regionErrs := make([]error, regionCount)
+	runOnWorkers(regionCount, func(regionIndex int) {
+		if s.checkContext() != nil {
+			return
+		}
+		worker := <-workers
+		regionCells := allRegionCells[regionCellStarts[regionIndex]:regionCellStarts[regionIndex+1]]
+		regionShapes[regionIndex], regionErrs[regionIndex] = findRegionShapes(worker, regionCells)
+		workers <- worker
+	})
+	close(workers)
+
+	for worker := range workers {
+		for index, nextWord := range worker.doneCells {
+			s.doneCells[index] |= nextWord
+		}
+		s.PointsRemoved += worker.PointsRemoved
+	}
+	if err := s.checkContext(); err != nil {
+		return err
+	}
+	for _, nextErr := range regionErrs {
+		if nextErr != nil {
+			return nextErr
+		}
+	}
+
+	// Each region's shapes are already in order, so go through the cells
+	// and take the shapes found from each one off the front of its region's
+	for rowY := 0; rowY < s.RowCount; rowY++ {
+		for colX := 0; colX < s.ColCount; colX++ {
+			region := s.regionLabels[colX*s.RowCount+rowY]
+			if region == 0 {
+				continue
+			}
+			cellOrder := rowY*s.ColCount + colX
+			nextShapes := regionShapes[region-1]
+			for len(nextShapes) > 0 && nextShapes[0].cellOrder == cellOrder {
+				if err := emit(nextShapes[0]); err != nil {
+					return err
+				}
+				nextShapes = nextShapes[1:]
+			}
+			regionShapes[region-1] = nextShapes
+		}
+	}
+	return nil
+}
+
+/*
+ * Same as processPolygons, but finding the polygons of several regions
+ * at a time. The polygons are only passed on once they have all been found.
+ */
+func (s *ShapeExtractor) processPolygonsInParallel(emit func(Polygon) error) error {
+	return s.processCentersInParallel(func(worker *ShapeExtractor, regionCells [][2]int) ([]cellShape, error) {
+		regionShapes := []cellShape{}
+		for _, nextCell := range regionCells {
+			colX, rowY := split2Int(nextCell)
+			nextPolygons, err := worker.getPolygonsFromCell(colX, rowY, 2, worker.getColor(colX, rowY))
+			if err != nil {
+				return nil, err
+			}
+			for _, newPoly := range nextPolygons {
+				regionShapes = append(regionShapes, cellShape{cellOrder: rowY*s.ColCount + colX, polygon: newPoly})
+			}
+		}
+		return regionShapes, nil
+	}, func(nextShape cellShape) error {
+		s.progress.PolygonsFound++
+		return emit(nextShape.polygon)
+	})
+}
+
+/*
+ * Same as processLines, but finding the lines of several regions at a time
+ */
+func (s *ShapeExtractor) processLinesInParallel(emit func(Line) error) error {
+	return s.processCentersInParallel(func(worker *ShapeExtractor, regionCells [][2]int) ([]cellShape, error) {
+		regionShapes := []cellShape{}
+		for _, nextCell := range regionCells {
+			colX, rowY := split2Int(nextCell)
+			if !worker.isDone(colX, rowY) {
+				nextLine := worker.getLine(colX, rowY)
+				regionShapes = append(regionShapes, cellShape{cellOrder: rowY*s.ColCount + colX, line: nextLine})
+			}
+		}
+		return regionShapes, nil
+	}, func(nextShape cellShape) error {
+		s.progress.LinesFound++
+		return emit(nextShape.line)
+	})
+}
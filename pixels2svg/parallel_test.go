@@ -0,0 +1,182 @@
+package pixels2svg
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+/*
+ * Finding the regions in parallel gives exactly the same polygons
+ * as finding them one after the other
+ */
+func TestProcessAllRegionsParallel(t *testing.T) {
+	transparentGrid := getNoisyColorGrid(37, 23, 3)
+	for colX := range transparentGrid {
+		for rowY := range transparentGrid[colX] {
+			if transparentGrid[colX][rowY][0] == 0 {
+				transparentGrid[colX][rowY][3] = 0
+			}
+		}
+	}
+
+	allGrids := map[string][][][4]uint8{
+		"noisy":       getNoisyColorGrid(37, 23, 2),
+		"few colors":  getNoisyColorGrid(50, 41, 5),
+		"big":         getBigColorGrid(),
+		"uniform":     getUniformColorGrid(30, 30),
+		"transparent": transparentGrid,
+	}
+	allConfigs := []Config{
+		{TraceEdges: true},
+		{TraceEdges: true, Connectivity: FourConnected},
+		{TraceEdges: true, DiagonalTieBreak: DarkerWins},
+		{TraceEdges: true, UseAlpha: true, Simplifier: VisvalingamWhyatt{Tolerance: 1}},
+		{MergeByColor: true, RegionColor: MeanColor},
+	}
+
+	for gridName, colorGrid := range allGrids {
+		for configIndex, config := range allConfigs {
+			s, _ := NewShapeExtractor(colorGrid, config)
+			expected := s.ProcessAllRegions()
+			expectedRemoved := s.PointsRemoved
+
+			for _, tileSize := range []int{1, 4, 7, 0} {
+				config.Parallel = true
+				config.TileSize = tileSize
+				s, _ = NewShapeExtractor(colorGrid, config)
+				results := s.ProcessAllRegions()
+
+				errText := comparePolygons(results, expected)
+				for index := 0; errText == "" && index < len(results); index++ {
+					errText = comparePolygonPointsSlices(results[index].Holes, expected[index].Holes)
+				}
+				if errText != "" {
+					t.Errorf("For the %s grid, config %d and tile size %d: %s", gridName, configIndex, tileSize, errText)
+				}
+				if s.PointsRemoved != expectedRemoved {
+					t.Errorf(
+						"For the %s grid, config %d and tile size %d: expected %d points removed, but got %d",
+						gridName,
+						configIndex,
+						tileSize,
+						expectedRemoved,
+						s.PointsRemoved,
+					)
+				}
+			}
+		}
+	}
+}
+
+/*
+ * Tracing through the pixel centers in parallel also gives exactly the
+ * same shapes, in the same order
+ */
+func TestGetAllShapesParallel(t *testing.T) {
+	transparentGrid := getNoisyColorGrid(37, 23, 3)
+	for colX := range transparentGrid {
+		for rowY := range transparentGrid[colX] {
+			if transparentGrid[colX][rowY][0] == 0 {
+				transparentGrid[colX][rowY][3] = 0
+			}
+		}
+	}
+
+	allGrids := map[string][][][4]uint8{
+		"noisy":       getNoisyColorGrid(37, 23, 2),
+		"few colors":  getNoisyColorGrid(50, 41, 5),
+		"big":         getBigColorGrid(),
+		"uniform":     getUniformColorGrid(30, 30),
+		"transparent": transparentGrid,
+	}
+	allConfigs := []Config{
+		{},
+		{Connectivity: FourConnected},
+		{DiagonalTieBreak: DarkerWins},
+		{UseAlpha: true, SkipReduction: true},
+		{RegionColor: MeanColor, MinRegionSize: 3},
+		{Simplifier: DouglasPeucker{Tolerance: 1}},
+	}
+
+	for gridName, colorGrid := range allGrids {
+		for configIndex, config := range allConfigs {
+			s, _ := NewShapeExtractor(colorGrid, config)
+			expectedPolygons, expectedLines := s.GetAllShapes()
+			expectedRemoved := s.PointsRemoved
+
+			for _, tileSize := range []int{1, 7, 0} {
+				config.Parallel = true
+				config.TileSize = tileSize
+				s, _ = NewShapeExtractor(colorGrid, config)
+				resultPolygons, resultLines := s.GetAllShapes()
+
+				errText := comparePolygons(resultPolygons, expectedPolygons)
+				if errText == "" {
+					errText = compareLines(resultLines, expectedLines)
+				}
+				if errText != "" {
+					t.Errorf("For the %s grid, config %d and tile size %d: %s", gridName, configIndex, tileSize, errText)
+				}
+				if s.PointsRemoved != expectedRemoved {
+					t.Errorf(
+						"For the %s grid, config %d and tile size %d: expected %d points removed, but got %d",
+						gridName,
+						configIndex,
+						tileSize,
+						expectedRemoved,
+						s.PointsRemoved,
+					)
+				}
+				if doneCount := s.doneCells.count(); doneCount == 0 {
+					t.Errorf("For the %s grid, config %d and tile size %d: expected the cells to be done", gridName, configIndex, tileSize)
+				}
+			}
+		}
+	}
+}
+
+/*
+ * Parallel with an option it can't be used with gives an error,
+ * rather than being left out
+ */
+func TestConvertParallelUnsupported(t *testing.T) {
+	colorGrid := getNoisyColorGrid(20, 20, 4)
+	allConfigs := map[string]Config{
+		"the Rectangles strategy": {Strategy: Rectangles, Parallel: true},
+		"ColorTolerance":          {ColorTolerance: 10, Parallel: true},
+		"SharedBorders":           {TraceEdges: true, SharedBorders: true, Parallel: true},
+	}
+
+	for reason, config := range allConfigs {
+		_, err := Convert(colorGrid, config)
+		if !errors.Is(err, ErrParallelUnsupported) {
+			t.Errorf("For %s, expected ErrParallelUnsupported, but got %v", reason, err)
+		} else if !strings.HasSuffix(err.Error(), reason) {
+			t.Errorf("Expected the error to name %s, but got %v", reason, err)
+		}
+	}
+}
+
+func TestGetSVGTextParallel(t *testing.T) {
+	colorGrid := getNoisyColorGrid(64, 48, 3)
+	expected, _ := Convert(colorGrid, Config{TraceEdges: true})
+	results, _ := Convert(colorGrid, Config{TraceEdges: true, Parallel: true, TileSize: 16})
+
+	if results.SVG != expected.SVG {
+		t.Errorf("Expected svg\n%s\nbut got\n%s", expected.SVG, results.SVG)
+	}
+}
+
+func TestConvertParallelCenters(t *testing.T) {
+	colorGrid := getNoisyColorGrid(64, 48, 3)
+	expected, _ := Convert(colorGrid, Config{})
+	results, err := Convert(colorGrid, Config{Parallel: true, TileSize: 16})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if results.SVG != expected.SVG {
+		t.Errorf("Expected svg\n%s\nbut got\n%s", expected.SVG, results.SVG)
+	}
+}
@@ -1,13 +1,12 @@
 package pixels2svg
 
-import (
-	"bytes"
-	"fmt"
-	"os"
-)
+import "context"
 
 type evaluatorFunc func(int, int, [4]uint8) bool
 
+// Returned instead of a direction when no neighboring cell is good
+const badDirection = 8
+
 type Line struct {
 	ColorRGBA [4]uint8
 	ColX1     int
@@ -19,25 +18,71 @@ type Line struct {
 type Polygon struct {
 	ColorRGBA [4]uint8
 	Points    [][2]int
+	Holes     [][][2]int // Outlines of areas inside the polygon that aren't part of it
 }
 
+/*
+ * Finds the shapes in a grid of colors. It keeps the state of the grid it's
+ * working through, so it isn't safe for concurrent use. Use Convert for
+ * that, or a separate ShapeExtractor for each goroutine.
+ */
 type ShapeExtractor struct {
-	badDirection       int
-	grid               [][][4]uint8
-	alreadyDone        [][]bool
+	pixels             [][4]uint8 // Column by column (see getCellIndex)
+	doneCells          cellBitset
 	ColCount           int
 	RowCount           int
 	neighborEvaluators [8]evaluatorFunc
 	cellQueue          [][2]int
+	regionLabels       []int
+	usedEdges          []bool // For each edge from each vertex (see getEdgeIndex)
+	colorSums          [4]int // Of the cells marked done since resetColorSums
+	colorSumCount      int
+	sharedArcs         map[[4]int][][2]int
+	styleSheetColors   [][4]uint8 // In the order their classes were named
+	classNames         map[[4]uint8]string
+	initErr            error // Why the grid passed to Init can't be used
+	smallRegionsMerged bool
+	progress           Progress
+	reportedPhases     uint            // A bit for each phase reported during this scan
+	ctx                context.Context // While limitShapes is running (see checkContext)
+
+	// Whether hasEnclosedTransparency is known yet (see isTracingEdges)
+	transparencyChecked     bool
+	hasEnclosedTransparency bool
+
+	// The number of points Config.Simplifier has removed
+	PointsRemoved int
+
+	Config
 }
 
-func (s *ShapeExtractor) showAlreadyDone() {
-	done := s.alreadyDone
+type RegionColorMode int
+
+const (
+	SeedColor RegionColorMode = iota // The color of the shape's first cell
+	MeanColor                        // The average color of all its cells
+)
+
+type Connectivity int
 
+const (
+	EightConnected Connectivity = iota // Cells that touch at a corner join up
+	FourConnected                      // Only cells that share a side join up
+)
+
+type DiagonalTieBreak int
+
+const (
+	JoinBothDiagonals DiagonalTieBreak = iota // Both colors join up, with a pinched vertex
+	DarkerWins                                // Only the darker color joins up
+	LighterWins                               // Only the lighter color joins up
+)
+
+func (s *ShapeExtractor) showAlreadyDone() {
 	// Output already done grid
-	for rowY := 0; rowY < len(done[0]); rowY++ {
-		for colX := 0; colX < len(done); colX++ {
-			if done[colX][rowY] {
+	for rowY := 0; rowY < s.RowCount; rowY++ {
+		for colX := 0; colX < s.ColCount; colX++ {
+			if s.isDone(colX, rowY) {
 				print("1 ")
 			} else {
 				print("0 ")
@@ -64,12 +109,65 @@ func (s *ShapeExtractor) setNeighborEvaluators() {
 	}
 }
 
+/*
+ * Is the color the same as the seed color, or close enough to it
+ * according to ColorTolerance
+ */
+func (s *ShapeExtractor) isSimilarColor(color, seedColor [4]uint8) bool {
+	if color == seedColor {
+		return true
+	}
+	if s.ColorTolerance <= 0 {
+		return false
+	}
+
+	colorDistance := s.ColorDistance
+	if colorDistance == nil {
+		colorDistance = EuclideanRGBDistance
+	}
+	return colorDistance(color, seedColor) <= s.ColorTolerance
+}
+
 func (s *ShapeExtractor) isCellDoneOrDifferent(
 	nextCol, nextRow int,
 	color [4]uint8,
 ) bool {
-	// True if different color or alreadyDone
-	return s.grid[nextCol][nextRow] != color || s.alreadyDone[nextCol][nextRow]
+	// True if different color or already done
+	return s.isDone(nextCol, nextRow) || !s.isSimilarColor(s.getColor(nextCol, nextRow), color)
+}
+
+/*
+ * Mark a cell as already done and add its color to the sums
+ * for the mean color of the current shape
+ */
+func (s *ShapeExtractor) markCellDone(colX, rowY int) {
+	s.setDone(colX, rowY)
+	color := s.getColor(colX, rowY)
+	for channel := 0; channel < 4; channel++ {
+		s.colorSums[channel] += int(color[channel])
+	}
+	s.colorSumCount++
+}
+
+func (s *ShapeExtractor) resetColorSums() {
+	s.colorSums = [4]int{}
+	s.colorSumCount = 0
+}
+
+/*
+ * Get the color to fill the current shape with, based on RegionColor.
+ * Averages the cells marked done since the last resetColorSums.
+ */
+func (s *ShapeExtractor) getRegionColor(seedColor [4]uint8) [4]uint8 {
+	if s.RegionColor != MeanColor || s.colorSumCount == 0 {
+		return seedColor
+	}
+
+	meanColor := [4]uint8{}
+	for channel := 0; channel < 4; channel++ {
+		meanColor[channel] = uint8((s.colorSums[channel] + s.colorSumCount/2) / s.colorSumCount)
+	}
+	return meanColor
 }
 
 /*
@@ -125,7 +223,8 @@ func (s *ShapeExtractor) isNorthEastCellGood(
 	}
 	newCol, newRow := s.getCellInDirection(colX, rowY, 1)
 
-	return !s.isCellDoneOrDifferent(newCol, newRow, color)
+	return !s.isCellDoneOrDifferent(newCol, newRow, color) &&
+		s.areDiagonalCellsJoined(colX, rowY, newCol, newRow)
 }
 
 func (s *ShapeExtractor) isEastCellGood(
@@ -149,7 +248,8 @@ func (s *ShapeExtractor) isSouthEastCellGood(
 	}
 	newCol, newRow := s.getCellInDirection(colX, rowY, 3)
 
-	return !s.isCellDoneOrDifferent(newCol, newRow, color)
+	return !s.isCellDoneOrDifferent(newCol, newRow, color) &&
+		s.areDiagonalCellsJoined(colX, rowY, newCol, newRow)
 }
 
 func (s *ShapeExtractor) isSouthCellGood(
@@ -173,7 +273,8 @@ func (s *ShapeExtractor) isSouthWestCellGood(
 	}
 	newCol, newRow := s.getCellInDirection(colX, rowY, 5)
 
-	return !s.isCellDoneOrDifferent(newCol, newRow, color)
+	return !s.isCellDoneOrDifferent(newCol, newRow, color) &&
+		s.areDiagonalCellsJoined(colX, rowY, newCol, newRow)
 }
 
 func (s *ShapeExtractor) isWestCellGood(
@@ -197,7 +298,8 @@ func (s *ShapeExtractor) isNorthWestCellGood(
 	}
 	newCol, newRow := s.getCellInDirection(colX, rowY, 7)
 
-	return !s.isCellDoneOrDifferent(newCol, newRow, color)
+	return !s.isCellDoneOrDifferent(newCol, newRow, color) &&
+		s.areDiagonalCellsJoined(colX, rowY, newCol, newRow)
 }
 
 /*
@@ -275,7 +377,7 @@ func (s *ShapeExtractor) directionToGoodNeighboringCell(
 		newDirection = s.getAngledRightDirection(newDirection)
 	}
 
-	return s.badDirection
+	return badDirection
 }
 
 /*
@@ -304,11 +406,7 @@ func (s *ShapeExtractor) getCellInDirection(colX, rowY, nextDirection int) (int,
 		return colX - 1, rowY - 1
 	}
 
-	panic(fmt.Sprintf(
-		"Error: direction should be 0, 1, 2, 3, 4, 5, 6, 7.  Was passed: %d",
-		nextDirection,
-	))
-	return 0, 0
+	return colX, rowY // Not a direction. The public methods check for these.
 }
 
 /*
@@ -332,30 +430,71 @@ func (s *ShapeExtractor) getCellInDirection(colX, rowY, nextDirection int) (int,
 func (s *ShapeExtractor) OutlinePolygon(
 	colX, rowY, direction int,
 	color [4]uint8,
-) [][2]int {
-	outlinePoints := [][2]int{{colX, rowY}}
-	if s.alreadyDone[colX][rowY] {
-		return nil
+) ([][2]int, error) {
+	if err := s.checkCell(colX, rowY); err != nil {
+		return nil, err
+	}
+	if err := checkDirection(direction, 8); err != nil {
+		return nil, err
+	}
+	return s.outlinePolygon(colX, rowY, direction, color)
+}
+
+/*
+ * Each step of the walk only depends on the cell and the direction it came
+ * in from, so getting back to one of those without passing the starting
+ * cell means the walk is going round a loop that misses it. That can happen
+ * with ColorTolerance, when cells before the starting one that are similar
+ * to it aren't done. Then there's no polygon for the starting cell, and
+ * its cells are left for later shapes.
+ *
+ * The loop is found the way Brent's cycle detection does it: each step is
+ * compared with one saved step, which is moved up whenever the number of
+ * points gets to a power of 2. No walk without a loop has more steps than
+ * 8 times the number of cells.
+ */
+func (s *ShapeExtractor) outlinePolygon(
+	colX, rowY, direction int,
+	color [4]uint8,
+) ([][2]int, error) {
+	if s.isDone(colX, rowY) {
+		return nil, nil
 	}
+	outlinePoints := [][2]int{{colX, rowY}}
+	savedStep := [3]int{colX, rowY, direction}
+	maxPointCount := 8 * s.ColCount * s.RowCount
 	for {
+		if err := s.checkTrace(len(outlinePoints)); err != nil {
+			return nil, err
+		}
+
 		newDirection := s.directionToGoodNeighboringCell(colX, rowY, direction, color)
 
-		if newDirection >= s.badDirection {
+		if newDirection >= badDirection {
 			if len(outlinePoints) <= 2 {
-				return nil
+				return nil, nil
 			}
+			return outlinePoints, nil // A dead end, so it can't get back
 		}
 
 		newCol, newRow := s.getCellInDirection(colX, rowY, newDirection)
 
 		if newCol == outlinePoints[0][0] && newRow == outlinePoints[0][1] {
-			return outlinePoints
+			return outlinePoints, nil
 		}
 
 		colX = newCol
 		rowY = newRow
 		direction = newDirection
 		outlinePoints = append(outlinePoints, [2]int{colX, rowY})
+
+		nextStep := [3]int{colX, rowY, direction}
+		if nextStep == savedStep || len(outlinePoints) > maxPointCount {
+			return nil, nil
+		}
+		if len(outlinePoints)&(len(outlinePoints)-1) == 0 {
+			savedStep = nextStep
+		}
 	}
 }
 
@@ -364,20 +503,28 @@ func (s *ShapeExtractor) OutlinePolygon(
  * that have the same color and form a line
  *
  */
-func (s *ShapeExtractor) GetLine(startCol, startRow int) Line {
-	color := s.grid[startCol][startRow]
+func (s *ShapeExtractor) GetLine(startCol, startRow int) (Line, error) {
+	if err := s.checkCell(startCol, startRow); err != nil {
+		return Line{}, err
+	}
+	return s.getLine(startCol, startRow), nil
+}
+
+func (s *ShapeExtractor) getLine(startCol, startRow int) Line {
+	color := s.getColor(startCol, startRow)
+	s.resetColorSums()
 
 	newLine := Line{
-		ColorRGBA: color,
-		ColX1:     startCol,
-		RowY1:     startRow,
+		ColX1: startCol,
+		RowY1: startRow,
 	}
 	// I want it to start looking to the East
 	// That function starts looking to the "left", so tell it I'm facing South
 	direction := s.directionToGoodNeighboringCell(startCol, startRow, 4, color)
 
-	if direction >= s.badDirection {
-		s.alreadyDone[startCol][startRow] = true
+	if direction >= badDirection {
+		s.markCellDone(startCol, startRow)
+		newLine.ColorRGBA = color
 		newLine.ColX2 = startCol
 		newLine.RowY2 = startRow // Don't worry if it's just a dot
 		return newLine
@@ -394,36 +541,19 @@ func (s *ShapeExtractor) GetLine(startCol, startRow int) Line {
 			break
 		}
 
-		s.alreadyDone[prevCol][prevRow] = true
+		s.markCellDone(prevCol, prevRow)
 		prevCol = nextCol
 		prevRow = nextRow
 	}
 
-	s.alreadyDone[prevCol][prevRow] = true
+	s.markCellDone(prevCol, prevRow)
+	newLine.ColorRGBA = s.getRegionColor(color)
 	newLine.ColX2 = prevCol
 	newLine.RowY2 = prevRow
 
 	return newLine
 }
 
-func (s *ShapeExtractor) Init(colorGrid [][][4]uint8) {
-
-	s.badDirection = 8
-	s.ColCount = len(colorGrid)
-	s.RowCount = len(colorGrid[0])
-	s.grid = colorGrid
-	s.alreadyDone = [][]bool{}
-
-	// set the alreadyDone grid values
-	for colX := 0; colX < s.ColCount; colX++ {
-		nextColumn := []bool{}
-		for rowY := 0; rowY < s.RowCount; rowY++ {
-			nextColumn = append(nextColumn, false)
-		}
-		s.alreadyDone = append(s.alreadyDone, nextColumn)
-	}
-}
-
 /*
  * Given a cell on the grid. Get all the polygon outlines that follow
  * from that cell.
@@ -431,29 +561,66 @@ func (s *ShapeExtractor) Init(colorGrid [][][4]uint8) {
 func (s *ShapeExtractor) GetPolygonsFromCell(
 	colX, rowY, direction int,
 	color [4]uint8,
-) [][][2]int {
+) ([][][2]int, error) {
+	if err := s.checkCell(colX, rowY); err != nil {
+		return nil, err
+	}
+	if err := checkDirection(direction, 8); err != nil {
+		return nil, err
+	}
 
+	nextPolygons, err := s.getPolygonsFromCell(colX, rowY, direction, color)
+	if err != nil {
+		return nil, err
+	}
 	allPolygons := [][][2]int{}
-	outlinePoints := s.OutlinePolygon(colX, rowY, direction, color)
-	if len(outlinePoints) < 3 {
-		return allPolygons
+	for _, nextPolygon := range nextPolygons {
+		allPolygons = append(allPolygons, nextPolygon.Points)
+	}
+
+	return allPolygons, nil
+}
+
+/*
+ * Same as GetPolygonsFromCell, but with the color of each polygon
+ * (see RegionColor)
+ */
+func (s *ShapeExtractor) getPolygonsFromCell(
+	colX, rowY, direction int,
+	color [4]uint8,
+) ([]Polygon, error) {
+
+	allPolygons := []Polygon{}
+	outlinePoints, err := s.outlinePolygon(colX, rowY, direction, color)
+	if err != nil || len(outlinePoints) < 3 {
+		return allPolygons, err
 	}
 
+	s.setPhase(PhaseCleanup)
 	cleanedUpPolygons := CleanUpPolygonOutline(
 		outlinePoints,
 		[][][2]int{},
 		0,
 	)
 
+	s.setPhase(PhaseReduction)
 	for _, nextPolygon := range cleanedUpPolygons {
-		_, reducedPolygon := ReducePolygonOutline(nextPolygon)
+		reducedPolygon := nextPolygon
+		if !s.SkipReduction {
+			_, reducedPolygon = ReducePolygonOutline(nextPolygon)
+		}
 		if len(reducedPolygon) > 2 {
-			s.markPolygonAlreadyDone(nextPolygon)
-			allPolygons = append(allPolygons, reducedPolygon)
+			s.resetColorSums()
+			s.markPolygonCellsDone(nextPolygon, color)
+			allPolygons = append(allPolygons, Polygon{
+				ColorRGBA: s.getRegionColor(color),
+				Points:    s.simplifyOutline(reducedPolygon),
+			})
 		}
 	}
+	s.setPhase(PhaseTracing)
 
-	return allPolygons
+	return allPolygons, nil
 }
 
 /*
@@ -469,33 +636,30 @@ func (s *ShapeExtractor) addNeighborsToQueue(colX, rowY int, color [4]uint8) {
 
 		if isGood {
 			nextCol, nextRow := s.getCellInDirection(colX, rowY, direction)
-			s.alreadyDone[nextCol][nextRow] = true
+			s.markCellDone(nextCol, nextRow)
 			s.cellQueue = append(s.cellQueue, [2]int{nextCol, nextRow})
 		}
 	}
 }
 
 /*
- *  For each cell in the queue, mark it as already done
- * and remove it from the queue, but also
- * add its neighbors to the queue if they have the same color
- * and aren't done yet
+ *  For each cell in the queue, mark it as already done, but also
+ * add its neighbors to the end of the queue if they have the same color
+ * and aren't done yet. Keep going until the end of the queue.
+ * Then empty the queue, keeping its memory for the next polygon.
  */
 func (s *ShapeExtractor) markCellQueueDone(color [4]uint8) {
-	if len(s.cellQueue) < 1 {
-		return
+	for index := 0; index < len(s.cellQueue); index++ {
+		colX, rowY := split2Int(s.cellQueue[index])
+		s.addNeighborsToQueue(colX, rowY, color)
 	}
 
-	colX, rowY := split2Int(s.cellQueue[0])
-	s.addNeighborsToQueue(colX, rowY, color)
-	s.cellQueue = s.cellQueue[1:]
-
-	s.markCellQueueDone(color)
+	s.cellQueue = s.cellQueue[:0]
 }
 
 /*
  * Given a polygon with an outline starting at a certain cell, mark
- * all its points (outline and internal) as "alreadyDone".
+ * all its points (outline and internal) as already done.
  *
  * Assumes that the polygon outline is contiguous right-angle points.
  * Assumes first point is the highest row of the outline and the
@@ -507,25 +671,46 @@ func (s *ShapeExtractor) markCellQueueDone(color [4]uint8) {
  *
  */
 func (s *ShapeExtractor) markPolygonAlreadyDone(polygonOutline [][2]int) {
+	if len(polygonOutline) < 3 {
+		return
+	}
+	firstCol, firstRow := split2Int(polygonOutline[0])
+	s.markPolygonCellsDone(polygonOutline, s.getColor(firstCol, firstRow))
+}
+
+/*
+ * An outline can go through a cell more than once (e.g. along a spur one
+ * cell wide), so its color is only added to the sums the first time
+ */
+func (s *ShapeExtractor) markOutlineCellDone(colX, rowY int) {
+	if !s.isDone(colX, rowY) {
+		s.markCellDone(colX, rowY)
+	}
+}
+
+/*
+ * Same as markPolygonAlreadyDone, but only marks inner cells with colors
+ * similar to the given (seed) color
+ */
+func (s *ShapeExtractor) markPolygonCellsDone(polygonOutline [][2]int, color [4]uint8) {
 
 	if len(polygonOutline) < 3 {
 		return
 	}
 
 	s.setNeighborEvaluators()
-	s.cellQueue = [][2]int{}
+	s.cellQueue = s.cellQueue[:0]
 
 	// deal with first cell on its own
 	prevCol, prevRow := split2Int(polygonOutline[0])
-	color := s.grid[prevCol][prevRow]
-	s.alreadyDone[prevCol][prevRow] = true
+	s.markOutlineCellDone(prevCol, prevRow)
 
 	// Walk through outline and add cells to the right to the queue
 	// of cells to mark as already done
 	for _, nextPoint := range polygonOutline[1:] {
 		nextCol, nextRow := split2Int(nextPoint)
 		direction := s.getLatestDirection(prevCol, prevRow, nextCol, nextRow)
-		s.alreadyDone[nextCol][nextRow] = true
+		s.markOutlineCellDone(nextCol, nextRow)
 
 		// Get its cell to the "right" and if necessary, add to the queue
 		innerDirection := s.getRight90Direction(direction)
@@ -534,7 +719,7 @@ func (s *ShapeExtractor) markPolygonAlreadyDone(polygonOutline [][2]int) {
 		isGood := evaluator(nextCol, nextRow, color)
 		if isGood {
 			innerCol, innerRow := s.getCellInDirection(nextCol, nextRow, innerDirection)
-			s.alreadyDone[innerCol][innerRow] = true
+			s.markCellDone(innerCol, innerRow)
 
 			s.cellQueue = append(s.cellQueue, [2]int{innerCol, innerRow})
 		}
@@ -546,7 +731,7 @@ func (s *ShapeExtractor) markPolygonAlreadyDone(polygonOutline [][2]int) {
 		isGood = evaluator(nextCol, nextRow, color)
 		if isGood {
 			innerCol, innerRow := s.getCellInDirection(nextCol, nextRow, innerDirection)
-			s.alreadyDone[innerCol][innerRow] = true
+			s.markCellDone(innerCol, innerRow)
 
 			s.cellQueue = append(s.cellQueue, [2]int{innerCol, innerRow})
 		}
@@ -560,137 +745,265 @@ func (s *ShapeExtractor) markPolygonAlreadyDone(polygonOutline [][2]int) {
 	// println("\n")
 }
 
-func (s *ShapeExtractor) ProcessAllPolygons() []Polygon {
+/*
+ * If alpha values are being used, mark all the fully transparent cells
+ * as already done, so that they don't end up in any shapes.
+ */
+func (s *ShapeExtractor) markTransparentCellsDone() {
+	if !s.UseAlpha {
+		return
+	}
+	for colX := 0; colX < s.ColCount; colX++ {
+		for rowY := 0; rowY < s.RowCount; rowY++ {
+			if s.getColor(colX, rowY)[3] == 0 {
+				s.setDone(colX, rowY)
+			}
+		}
+	}
+}
+
+/*
+ * Is there a transparent area that can't be reached from the sides of
+ * the grid without going through cells of other colors
+ */
+func (s *ShapeExtractor) hasEnclosedTransparentCells() bool {
+	isTransparent := func(cellIndex int) bool {
+		return s.pixels[cellIndex][3] == 0
+	}
+
+	// Flood the transparent cells from the sides of the grid inwards
+	reached := makeCellBitset(nil, len(s.pixels))
+	cellQueue := []int{}
+	for colX := 0; colX < s.ColCount; colX++ {
+		for rowY := 0; rowY < s.RowCount; rowY++ {
+			isOnSide := colX == 0 || rowY == 0 || colX == s.ColCount-1 || rowY == s.RowCount-1
+			cellIndex := s.getCellIndex(colX, rowY)
+			if isOnSide && isTransparent(cellIndex) {
+				reached.set(cellIndex)
+				cellQueue = append(cellQueue, cellIndex)
+			}
+		}
+	}
+	for index := 0; index < len(cellQueue); index++ {
+		colX := cellQueue[index] / s.RowCount
+		rowY := cellQueue[index] % s.RowCount
+		for _, offset := range edgeOffsets {
+			nextCol := colX + offset[0]
+			nextRow := rowY + offset[1]
+			if nextCol < 0 || nextRow < 0 || nextCol >= s.ColCount || nextRow >= s.RowCount {
+				continue
+			}
+			cellIndex := s.getCellIndex(nextCol, nextRow)
+			if !reached.get(cellIndex) && isTransparent(cellIndex) {
+				reached.set(cellIndex)
+				cellQueue = append(cellQueue, cellIndex)
+			}
+		}
+	}
+
+	for cellIndex := range s.pixels {
+		if isTransparent(cellIndex) && !reached.get(cellIndex) {
+			return true
+		}
+	}
+	return false
+}
+
+/*
+ * Should the outlines be traced along the pixel edges. Besides with
+ * TraceEdges and MergeByColor, that's needed with UseAlpha when there's
+ * a transparent area inside a shape: outlines through the pixel centers
+ * can't have holes, so the shape would cover the transparent area.
+ */
+func (s *ShapeExtractor) isTracingEdges() bool {
+	if s.TraceEdges || s.MergeByColor {
+		return true
+	}
+	if !s.UseAlpha {
+		return false
+	}
+
+	// The small regions are merged first, since that can change which
+	// cells are transparent
+	if !s.transparencyChecked {
+		s.mergeSmallRegionsOnce()
+		s.hasEnclosedTransparency = s.hasEnclosedTransparentCells()
+		s.transparencyChecked = true
+	}
+	return s.hasEnclosedTransparency
+}
+
+/*
+ * Goes through the grid, cell by cell, and gets all the polygons.
+ * Passes each polygon to emit as soon as it's found and stops at the
+ * first error emit returns.
+ */
+func (s *ShapeExtractor) processPolygons(emit func(Polygon) error) error {
 	startDirection := 2
-	allPolygons := []Polygon{}
+	s.prepareGrid()
+	if s.canProcessInParallel() {
+		return s.processPolygonsInParallel(emit)
+	}
 
 	// Start at top left and move to the right, then down a row, then right ...
 	for rowIndex := 0; rowIndex < s.RowCount; rowIndex++ {
 		for colIndex := 0; colIndex < s.ColCount; colIndex++ {
-			color := s.grid[colIndex][rowIndex]
-			nextPolygons := s.GetPolygonsFromCell(
+			color := s.getColor(colIndex, rowIndex)
+			nextPolygons, err := s.getPolygonsFromCell(
 				colIndex,
 				rowIndex,
 				startDirection,
 				color,
 			)
-			for _, nextPoly := range nextPolygons {
-				newPoly := Polygon{
-					ColorRGBA: color,
-					Points:    nextPoly,
+			if err != nil {
+				return err
+			}
+			for _, newPoly := range nextPolygons {
+				s.progress.PolygonsFound++
+				if err := emit(newPoly); err != nil {
+					return err
 				}
-				allPolygons = append(allPolygons, newPoly)
 			}
 		}
+		s.rowScanned()
+		if err := s.checkContext(); err != nil {
+			return err
+		}
 	}
 
+	return nil
+}
+
+func (s *ShapeExtractor) ProcessAllPolygons() []Polygon {
+	allPolygons := []Polygon{}
+	s.processPolygons(func(nextPolygon Polygon) error {
+		allPolygons = append(allPolygons, nextPolygon)
+		return nil
+	})
+
 	return allPolygons
 }
 
 /*
  * Goes through the grid, cell by cell, and gets all the lines of the same color.
- *
+ * Passes each line to emit as soon as it's found and stops at the
+ * first error emit returns.
  */
-func (s *ShapeExtractor) ProcessAllLines() []Line {
-	allLines := []Line{}
+func (s *ShapeExtractor) processLines(emit func(Line) error) error {
+	s.prepareGrid()
+	if s.canProcessInParallel() {
+		return s.processLinesInParallel(emit)
+	}
 
 	// Start at top left and move to the right, then down a row, then right ...
 	for rowIndex := 0; rowIndex < s.RowCount; rowIndex++ {
 		for colIndex := 0; colIndex < s.ColCount; colIndex++ {
-			if !s.alreadyDone[colIndex][rowIndex] {
-				nextLine := s.GetLine(colIndex, rowIndex)
-				allLines = append(allLines, nextLine)
+			if !s.isDone(colIndex, rowIndex) {
+				nextLine := s.getLine(colIndex, rowIndex)
+				s.progress.LinesFound++
+				if err := emit(nextLine); err != nil {
+					return err
+				}
 			}
 		}
+		s.rowScanned()
+		if err := s.checkContext(); err != nil {
+			return err
+		}
 	}
 
-	return allLines
+	return nil
 }
 
-func (s *ShapeExtractor) GetAllShapes() ([]Polygon, []Line) {
-	s.setNeighborEvaluators()
-	allPolygons := s.ProcessAllPolygons()
-	allLines := s.ProcessAllLines()
+/*
+ * Goes through the grid, cell by cell, and gets all the lines of the same color.
+ *
+ */
+func (s *ShapeExtractor) ProcessAllLines() []Line {
+	allLines := []Line{}
+	s.processLines(func(nextLine Line) error {
+		allLines = append(allLines, nextLine)
+		return nil
+	})
 
-	return allPolygons, allLines
+	return allLines
 }
 
-func (s *ShapeExtractor) GetSVGText() string {
-	allPolygons, allLines := s.GetAllShapes()
-
-	svgWidth := s.ColCount
-	svgHeight := s.RowCount
-
-	var svgBuffer bytes.Buffer // Concatenation is more economical with a Buffer
-	svgBuffer.WriteString(
-		fmt.Sprintf(`<svg width="%d" height="%d">`, svgWidth, svgHeight),
-	)
-	svgBuffer.WriteString("\n <g>\n")
-
-	for _, next := range allPolygons {
-		hexColor := GetHexColor(next.ColorRGBA)
-		svgBuffer.WriteString(fmt.Sprintf(`  <polygon class="%s" points="`, hexColor))
-
-		for _, nextPoint := range next.Points {
-			svgBuffer.WriteString(fmt.Sprintf("%d,%d ", nextPoint[0], nextPoint[1]))
-		}
-		svgBuffer.WriteString(fmt.Sprintf(`" stroke="%s" fill="%s" />`, hexColor, hexColor))
-		svgBuffer.WriteString("\n")
+/*
+ * Gets all the shapes, one at a time, passing each one on as soon as
+ * it's found (polygons first, then lines, or only rectangles for the
+ * Rectangles strategy).
+ */
+func (s *ShapeExtractor) processAllShapes(
+	emitPolygon func(Polygon) error,
+	emitLine func(Line) error,
+	emitRectangle func(Rectangle) error,
+) error {
+	s.setNeighborEvaluators()
+	if err := s.checkParallel(); err != nil {
+		return err
 	}
-
-	for _, next := range allLines {
-		hexColor := GetHexColor(next.ColorRGBA)
-
-		svgBuffer.WriteString(fmt.Sprintf(`  <line class="%s" `, hexColor))
-		svgBuffer.WriteString(fmt.Sprintf(`x1="%d" y1="%d" `, next.ColX1, next.RowY1))
-		svgBuffer.WriteString(fmt.Sprintf(`x2="%d" y2="%d" `, next.ColX2, next.RowY2))
-		svgBuffer.WriteString(fmt.Sprintf(`stroke="%s" fill="%s" />`, hexColor, hexColor))
-		svgBuffer.WriteString("\n")
+	if s.Strategy == Rectangles {
+		s.resetProgress(1)
+		return s.processRectangles(emitRectangle)
 	}
-
-	svgBuffer.WriteString(" </g>\n</svg>")
-
-	return svgBuffer.String()
-}
-
-func (s *ShapeExtractor) WriteSVGToFile(filePath string) error {
-	f, err := os.Create(filePath)
-	defer f.Close()
-	if err != nil {
-		return err
+	if s.isTracingEdges() {
+		s.resetProgress(1)
+		return s.processRegions(emitPolygon)
 	}
-	_, err = f.WriteString(s.GetSVGText())
-	if err == nil {
-		println("\nWrote SVG to ", filePath)
+	s.resetProgress(2)
+	if err := s.processPolygons(emitPolygon); err != nil {
+		return err
 	}
-	return err
+	s.startPass()
+	return s.processLines(emitLine)
 }
 
-func GetHexColor(colorRGBA [4]uint8) string {
-	return fmt.Sprintf("#%02X%02X%02X", colorRGBA[0], colorRGBA[1], colorRGBA[2])
+/*
+ * Gets all the shapes. For the Rectangles strategy, the rectangles are
+ * returned as polygons.
+ */
+func (s *ShapeExtractor) GetAllShapes() ([]Polygon, []Line) {
+	allPolygons := []Polygon{}
+	allLines := []Line{}
+
+	s.processAllShapes(
+		func(nextPolygon Polygon) error {
+			allPolygons = append(allPolygons, nextPolygon)
+			return nil
+		},
+		func(nextLine Line) error {
+			allLines = append(allLines, nextLine)
+			return nil
+		},
+		func(nextRectangle Rectangle) error {
+			allPolygons = append(allPolygons, nextRectangle.GetPolygon())
+			return nil
+		},
+	)
+
+	return allPolygons, allLines
 }
 
 /*
  * Given an outline of a polygon on a grid, find the pair of indexes
  *  where there is the first overlap and return that pair.
  * Returns empty array if no overlap
+ *
+ * Remembers the first index of each point, so it only goes through the
+ * outline once. A point that just repeats the one before it doesn't count.
  */
 func FindOutlineOverlap(outlinePoints [][2]int) [2]int {
-	if len(outlinePoints) == 0 {
-		return [2]int{}
-	}
-
-	for outerIndex, outerPoint := range outlinePoints[1:] {
-		outerColX := outerPoint[0]
-		outerRowY := outerPoint[1]
+	firstIndexes := make(map[[2]int]int, len(outlinePoints))
 
-		for innerIndex, innerPoint := range outlinePoints[0:outerIndex] {
-			innerColX := innerPoint[0]
-			innerRowY := innerPoint[1]
-
-			if outerColX == innerColX && outerRowY == innerRowY {
-				return [2]int{innerIndex, outerIndex + 1} // Add to outerIndex, since it starts at 1
-			}
+	for index, nextPoint := range outlinePoints {
+		firstIndex, found := firstIndexes[nextPoint]
+		if !found {
+			firstIndexes[nextPoint] = index
+			continue
+		}
+		if firstIndex < index-1 {
+			return [2]int{firstIndex, index}
 		}
 	}
 
@@ -700,6 +1013,11 @@ func FindOutlineOverlap(outlinePoints [][2]int) [2]int {
 /*
  * Given an outline of a polygon on a grid, purge out the sections that
  * loop back on themselves and return a slice of those sections.
+ * The first polygon returned is what's left of the outline.
+ *
+ * Goes through the outline once, keeping the points that are left so far
+ * and the index of each of them. When a point comes back to one of those,
+ * the section since then is purged.
  */
 func CleanUpPolygonOutline(
 	outlinePoints [][2]int,
@@ -707,35 +1025,44 @@ func CleanUpPolygonOutline(
 	startIndex int,
 ) [][][2]int {
 
-	allPolygons := [][][2]int{outlinePoints}
-	allPolygons = append(allPolygons, purgedOutlines...)
-
 	if len(outlinePoints) <= startIndex {
-		return allPolygons
+		allPolygons := [][][2]int{outlinePoints}
+		return append(allPolygons, purgedOutlines...)
 	}
 
-	overlapPoints := FindOutlineOverlap(outlinePoints)
-	if overlapPoints == [2]int{} {
-		return allPolygons
-	}
+	keptPoints := make([][2]int, 0, len(outlinePoints)) // Avoid modifying original
+	keptIndexes := make(map[[2]int]int, len(outlinePoints))
 
-	newOutline := [][2]int{} // Create new slice to avoid  modifying original
-	newOutline = append(newOutline, outlinePoints[:overlapPoints[0]]...)
-	newOutline = append(newOutline, outlinePoints[overlapPoints[1]:]...)
+	for _, nextPoint := range outlinePoints {
+		keptIndex, found := keptIndexes[nextPoint]
+
+		// A point that just repeats the one before it isn't an overlap
+		if found && keptIndex < len(keptPoints)-1 {
+			newPurge := [][2]int{}
+			newPurge = append(newPurge, keptPoints[keptIndex:]...)
+
+			for _, purgedPoint := range newPurge {
+				if keptIndexes[purgedPoint] >= keptIndex {
+					delete(keptIndexes, purgedPoint)
+				}
+			}
+			keptPoints = keptPoints[:keptIndex]
+			found = false
 
-	newPurge := [][2]int{}
-	newPurge = append(newPurge, outlinePoints[overlapPoints[0]:overlapPoints[1]]...)
+			// Only include sections that have at least two points
+			if len(newPurge) > 2 {
+				purgedOutlines = append(purgedOutlines, newPurge)
+			}
+		}
 
-	// Only include sections that have at least two points
-	if len(newPurge) > 2 {
-		purgedOutlines = append(purgedOutlines, newPurge)
+		if !found {
+			keptIndexes[nextPoint] = len(keptPoints)
+		}
+		keptPoints = append(keptPoints, nextPoint)
 	}
 
-	return CleanUpPolygonOutline(
-		newOutline,
-		purgedOutlines,
-		overlapPoints[0]+1,
-	)
+	allPolygons := [][][2]int{keptPoints}
+	return append(allPolygons, purgedOutlines...)
 }
 
 func getDirection(num1, num2 int, increasingLetter, decreasingLetter string) string {
@@ -907,3 +1234,55 @@ func IsPointIn2IntArray(colX, rowY int, outlinePoints [][2]int) bool {
 func split2Int(inArray [2]int) (int, int) {
 	return inArray[0], inArray[1]
 }
+
+/*
+ * Two cells that only touch at a corner. Can they be part of the same shape
+ * (when their colors match), based on Connectivity and DiagonalTieBreak?
+ * Only looks at colors, so that the cells on the other diagonal always
+ * get the opposite answer in a tie.
+ */
+func (s *ShapeExtractor) areDiagonalCellsJoined(colX1, rowY1, colX2, rowY2 int) bool {
+	if s.Connectivity == FourConnected {
+		return false
+	}
+	if s.DiagonalTieBreak == JoinBothDiagonals {
+		return true
+	}
+
+	color1 := s.getColor(colX1, rowY1)
+	color2 := s.getColor(colX2, rowY2)
+	crossColor1 := s.getColor(colX2, rowY1)
+	crossColor2 := s.getColor(colX1, rowY2)
+
+	isTie := s.isSimilarColor(color2, color1) &&
+		s.isSimilarColor(crossColor2, crossColor1) &&
+		!s.isSimilarColor(crossColor1, color1)
+	if !isTie {
+		return true
+	}
+
+	isDarker := isDarkerColor(color1, crossColor1)
+	if s.DiagonalTieBreak == DarkerWins {
+		return isDarker
+	}
+	return !isDarker
+}
+
+/*
+ * Is the first color darker than the second (by luma, then by channel
+ * values, so that two different colors are never equally dark)
+ */
+func isDarkerColor(color1, color2 [4]uint8) bool {
+	luma1 := 2126*int(color1[0]) + 7152*int(color1[1]) + 722*int(color1[2])
+	luma2 := 2126*int(color2[0]) + 7152*int(color2[1]) + 722*int(color2[2])
+	if luma1 != luma2 {
+		return luma1 < luma2
+	}
+
+	for channel := 0; channel < 4; channel++ {
+		if color1[channel] != color2[channel] {
+			return color1[channel] < color2[channel]
+		}
+	}
+	return false
+}
@@ -2,6 +2,9 @@ package pixels2svg
 
 import (
 	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
 	"testing"
 )
 
@@ -21,6 +24,20 @@ func compareBoolSlices(results, expected []bool) string {
 	return ""
 }
 
+/*
+ * Which cells are already done, as a grid ([column][row])
+ */
+func getDoneGrid(s *ShapeExtractor) [][]bool {
+	doneGrid := make([][]bool, s.ColCount)
+	for colX := range doneGrid {
+		doneGrid[colX] = make([]bool, s.RowCount)
+		for rowY := range doneGrid[colX] {
+			doneGrid[colX][rowY] = s.isDone(colX, rowY)
+		}
+	}
+	return doneGrid
+}
+
 func compareBoolGrids(results, expected [][]bool) string {
 	resultsCount := len(results)
 	expectedCount := len(expected)
@@ -275,7 +292,7 @@ func TestGetColorRowPartRowDifferentColor(t *testing.T) {
 	startRow := 0
 
 	differentColumn := 3
-	s.grid[differentColumn][startRow] = [4]uint8{9, 9, 9, 9}
+	s.setColor(differentColumn, startRow, [4]uint8{9, 9, 9, 9})
 
 	results := s.getColorRow(startCol, startRow, [4]uint8{1, 1, 1, 1})
 	expected := differentColumn - 1
@@ -293,7 +310,7 @@ func TestGetColorRowPartRowAlreadyDone(t *testing.T) {
 	startCol := 1
 	startRow := 1
 
-	s.alreadyDone[doneColumn][startRow] = true
+	s.setDone(doneColumn, startRow)
 
 	results := s.getColorRow(startCol, startRow, [4]uint8{1, 1, 1, 1})
 	expected := doneColumn - 1
@@ -310,7 +327,7 @@ func TestGetColorRowNoMore(t *testing.T) {
 	startRow := 1
 	startCol := 2
 	doneColumn := startCol + 1
-	s.alreadyDone[doneColumn][startRow] = true
+	s.setDone(doneColumn, startRow)
 
 	results := s.getColorRow(startCol, startRow, [4]uint8{1, 1, 1, 1})
 	expected := startCol
@@ -327,7 +344,11 @@ func TestGetLineHorizontalWhole(t *testing.T) {
 	startCol := 0
 	startRow := 0
 
-	results := s.GetLine(startCol, startRow)
+	results, lineErr := s.GetLine(startCol, startRow)
+	if lineErr != nil {
+		t.Errorf("Unexpected error: %v", lineErr)
+		return
+	}
 
 	expected := Line{
 		ColorRGBA: [4]uint8{1, 1, 1, 1},
@@ -346,11 +367,15 @@ func TestGetLineHorizontalWhole(t *testing.T) {
 func TestGetLineHorizontalPartial(t *testing.T) {
 	var s ShapeExtractor
 	s.Init(getColorGrid())
-	s.grid[s.ColCount-1][1] = [4]uint8{9, 9, 9, 9}
+	s.setColor(s.ColCount-1, 1, [4]uint8{9, 9, 9, 9})
 	startCol := 1
 	startRow := 1
 
-	results := s.GetLine(startCol, startRow)
+	results, lineErr := s.GetLine(startCol, startRow)
+	if lineErr != nil {
+		t.Errorf("Unexpected error: %v", lineErr)
+		return
+	}
 
 	expected := Line{
 		ColorRGBA: [4]uint8{1, 1, 1, 1},
@@ -373,7 +398,11 @@ func TestGetLineLastColumnWhole(t *testing.T) {
 	startCol := s.ColCount - 1
 	startRow := 0
 
-	results := s.GetLine(startCol, startRow)
+	results, lineErr := s.GetLine(startCol, startRow)
+	if lineErr != nil {
+		t.Errorf("Unexpected error: %v", lineErr)
+		return
+	}
 
 	expected := Line{
 		ColorRGBA: [4]uint8{1, 1, 1, 1},
@@ -392,16 +421,20 @@ func TestGetLineLastColumnWhole(t *testing.T) {
 func TestGetLineVerticalPartial(t *testing.T) {
 	var s ShapeExtractor
 	s.Init(getColorGrid())
-	s.alreadyDone[1][0] = true
-	s.alreadyDone[2][0] = true
-	s.grid[2][1] = [4]uint8{2, 2, 2, 2}
-	s.grid[2][2] = [4]uint8{2, 2, 2, 2}
-	s.grid[1][s.RowCount-1] = [4]uint8{2, 2, 2, 2}
+	s.setDone(1, 0)
+	s.setDone(2, 0)
+	s.setColor(2, 1, [4]uint8{2, 2, 2, 2})
+	s.setColor(2, 2, [4]uint8{2, 2, 2, 2})
+	s.setColor(1, s.RowCount-1, [4]uint8{2, 2, 2, 2})
 
 	startCol := 1
 	startRow := 1
 
-	results := s.GetLine(startCol, startRow)
+	results, lineErr := s.GetLine(startCol, startRow)
+	if lineErr != nil {
+		t.Errorf("Unexpected error: %v", lineErr)
+		return
+	}
 
 	expected := Line{
 		ColorRGBA: [4]uint8{1, 1, 1, 1},
@@ -421,18 +454,22 @@ func TestGetLineVerticalPartial(t *testing.T) {
 func TestGetLineAngledPartial(t *testing.T) {
 	var s ShapeExtractor
 	s.Init(getColorGrid())
-	s.alreadyDone[3][0] = true
-	s.alreadyDone[4][0] = true
-	s.grid[4][1] = [4]uint8{2, 2, 2, 2}
-	s.grid[4][2] = [4]uint8{2, 2, 2, 2}
-	s.grid[4][3] = [4]uint8{2, 2, 2, 2}
-	s.grid[3][2] = [4]uint8{2, 2, 2, 2}
-	s.grid[1][s.RowCount-1] = [4]uint8{2, 2, 2, 2}
+	s.setDone(3, 0)
+	s.setDone(4, 0)
+	s.setColor(4, 1, [4]uint8{2, 2, 2, 2})
+	s.setColor(4, 2, [4]uint8{2, 2, 2, 2})
+	s.setColor(4, 3, [4]uint8{2, 2, 2, 2})
+	s.setColor(3, 2, [4]uint8{2, 2, 2, 2})
+	s.setColor(1, s.RowCount-1, [4]uint8{2, 2, 2, 2})
 
 	startCol := 3
 	startRow := 1
 
-	results := s.GetLine(startCol, startRow)
+	results, lineErr := s.GetLine(startCol, startRow)
+	if lineErr != nil {
+		t.Errorf("Unexpected error: %v", lineErr)
+		return
+	}
 
 	expected := Line{
 		ColorRGBA: [4]uint8{1, 1, 1, 1},
@@ -448,6 +485,43 @@ func TestGetLineAngledPartial(t *testing.T) {
 	}
 }
 
+// Same as TestGetLineAngledPartial, but the cells only touch at a corner
+func TestGetLineAngledFourConnected(t *testing.T) {
+	var s ShapeExtractor
+	s.Init(getColorGrid())
+	s.Connectivity = FourConnected
+	s.setDone(3, 0)
+	s.setDone(4, 0)
+	s.setColor(4, 1, [4]uint8{2, 2, 2, 2})
+	s.setColor(4, 2, [4]uint8{2, 2, 2, 2})
+	s.setColor(4, 3, [4]uint8{2, 2, 2, 2})
+	s.setColor(3, 2, [4]uint8{2, 2, 2, 2})
+	s.setColor(1, s.RowCount-1, [4]uint8{2, 2, 2, 2})
+	s.setColor(2, 1, [4]uint8{2, 2, 2, 2})
+
+	startCol := 3
+	startRow := 1
+
+	results, lineErr := s.GetLine(startCol, startRow)
+	if lineErr != nil {
+		t.Errorf("Unexpected error: %v", lineErr)
+		return
+	}
+
+	expected := Line{
+		ColorRGBA: [4]uint8{1, 1, 1, 1},
+		ColX1:     startCol,
+		RowY1:     startRow,
+		ColX2:     startCol,
+		RowY2:     startRow,
+	}
+
+	err := compareLines([]Line{results}, []Line{expected})
+	if err != "" {
+		t.Fatal(err)
+	}
+}
+
 func TestGetLineOneCell(t *testing.T) {
 	var s ShapeExtractor
 	s.Init(getColorGrid())
@@ -455,11 +529,15 @@ func TestGetLineOneCell(t *testing.T) {
 	startCol := 0
 	startRow := 0
 
-	s.grid[0][1] = [4]uint8{9, 9, 9, 9}
-	s.alreadyDone[1][0] = true
-	s.alreadyDone[1][1] = true
+	s.setColor(0, 1, [4]uint8{9, 9, 9, 9})
+	s.setDone(1, 0)
+	s.setDone(1, 1)
 
-	results := s.GetLine(startCol, startRow)
+	results, lineErr := s.GetLine(startCol, startRow)
+	if lineErr != nil {
+		t.Errorf("Unexpected error: %v", lineErr)
+		return
+	}
 
 	expected := Line{
 		ColorRGBA: [4]uint8{1, 1, 1, 1},
@@ -485,20 +563,24 @@ func TestOutlinePolygonPartial(t *testing.T) {
 	var s ShapeExtractor
 	s.Init(getColorGrid())
 
-	s.grid[1][1] = [4]uint8{9, 9, 9, 9}
-	s.grid[2][1] = [4]uint8{9, 9, 9, 9}
-	s.alreadyDone[0][1] = true
-	s.alreadyDone[0][2] = true
-	s.alreadyDone[2][0] = true
-	s.alreadyDone[3][0] = true
-	s.alreadyDone[4][0] = true
-	s.alreadyDone[4][3] = true
+	s.setColor(1, 1, [4]uint8{9, 9, 9, 9})
+	s.setColor(2, 1, [4]uint8{9, 9, 9, 9})
+	s.setDone(0, 1)
+	s.setDone(0, 2)
+	s.setDone(2, 0)
+	s.setDone(3, 0)
+	s.setDone(4, 0)
+	s.setDone(4, 3)
 
 	colX := 1
 	rowY := 2
 	direction := 2
 
-	results := s.OutlinePolygon(colX, rowY, direction, [4]uint8{1, 1, 1, 1})
+	results, outlineErr := s.OutlinePolygon(colX, rowY, direction, [4]uint8{1, 1, 1, 1})
+	if outlineErr != nil {
+		t.Errorf("Unexpected error: %v", outlineErr)
+		return
+	}
 	expected := [][2]int{
 		{1, 2},
 		{2, 2},
@@ -517,6 +599,39 @@ func TestOutlinePolygonPartial(t *testing.T) {
 	}
 }
 
+/*
+ * A ColorDistance whose answers change part way through the walk leaves
+ * it at a cell with no good neighbors. It stops there with the points
+ * it has, rather than going round and round the same cell.
+ */
+func TestOutlinePolygonDeadEnd(t *testing.T) {
+	seed := [4]uint8{1, 1, 1, 255}
+	other := [4]uint8{2, 2, 2, 255}
+
+	var s ShapeExtractor
+	s.Init([][][4]uint8{{seed, other}, {other, other}, {other, other}})
+	checkCount := 0
+	s.ColorTolerance = 1
+	s.ColorDistance = func(color1, color2 [4]uint8) float64 {
+		checkCount++
+		if checkCount > 3 {
+			return 100
+		}
+		return 0
+	}
+
+	results, outlineErr := s.OutlinePolygon(0, 0, 2, seed)
+	if outlineErr != nil {
+		t.Fatalf("Unexpected error: %v", outlineErr)
+	}
+	expected := [][2]int{{0, 0}, {1, 0}, {2, 0}, {2, 1}}
+
+	err := compareOutlinePoints(results, expected)
+	if err != "" {
+		t.Errorf("Polygon outline. %s", err)
+	}
+}
+
 func TestAddNeighborsToQueueTopEdge(t *testing.T) {
 	var s ShapeExtractor
 
@@ -525,13 +640,13 @@ func TestAddNeighborsToQueueTopEdge(t *testing.T) {
 	gridColors := getBigColorGrid()
 	s.Init(gridColors)
 	s.cellQueue = [][2]int{}
-	red := s.grid[0][0]
+	red := s.getColor(0, 0)
 
 	// outline and already done points
-	s.alreadyDone[2][0] = true
-	s.alreadyDone[3][0] = true
-	s.alreadyDone[4][0] = true
-	s.alreadyDone[2][1] = true
+	s.setDone(2, 0)
+	s.setDone(3, 0)
+	s.setDone(4, 0)
+	s.setDone(2, 1)
 
 	s.addNeighborsToQueue(3, 1, red)
 	results := s.cellQueue
@@ -551,14 +666,14 @@ func TestAddNeighborsToQueueTopRightCorner(t *testing.T) {
 	gridColors := getBigColorGrid()
 	s.Init(gridColors)
 	s.cellQueue = [][2]int{}
-	red := s.grid[0][0]
+	red := s.getColor(0, 0)
 
-	s.alreadyDone[3][0] = true
-	s.alreadyDone[4][0] = true
-	s.alreadyDone[5][0] = true
-	s.alreadyDone[5][1] = true
-	s.alreadyDone[5][2] = true
-	s.alreadyDone[3][1] = true
+	s.setDone(3, 0)
+	s.setDone(4, 0)
+	s.setDone(5, 0)
+	s.setDone(5, 1)
+	s.setDone(5, 2)
+	s.setDone(3, 1)
 
 	s.addNeighborsToQueue(4, 1, red) // (5, 0) and (5, 1) are on outline
 	results := s.cellQueue
@@ -578,13 +693,13 @@ func TestAddNeighborsToQueueByInnerDiff(t *testing.T) {
 	gridColors := getBigColorGrid()
 	s.Init(gridColors)
 	s.cellQueue = [][2]int{}
-	red := s.grid[0][0]
+	red := s.getColor(0, 0)
 
-	s.alreadyDone[2][2] = true
-	s.alreadyDone[3][2] = true
-	s.alreadyDone[4][2] = true
-	s.alreadyDone[5][2] = true
-	s.alreadyDone[5][3] = true
+	s.setDone(2, 2)
+	s.setDone(3, 2)
+	s.setDone(4, 2)
+	s.setDone(5, 2)
+	s.setDone(5, 3)
 
 	s.addNeighborsToQueue(3, 3, red)
 	results := s.cellQueue
@@ -656,7 +771,7 @@ func TestMarkPolygonAlreadyDonePartial(t *testing.T) {
 
 	s.markPolygonAlreadyDone(outlinePoints)
 
-	results := s.alreadyDone
+	results := getDoneGrid(&s)
 	expected := [][]bool{
 		{false, false, true, true, true, true}, //  column 0
 		{false, true, true, false, true, true}, //  column 1
@@ -828,6 +943,105 @@ func TestCleanUpPolygonOutlineNoOverlaps(t *testing.T) {
 
 }
 
+/*
+ * The original versions of FindOutlineOverlap and CleanUpPolygonOutline,
+ * which compare each point with all the points before it.
+ * Kept to check the faster versions against.
+ */
+func findOutlineOverlapQuadratic(outlinePoints [][2]int) [2]int {
+	if len(outlinePoints) == 0 {
+		return [2]int{}
+	}
+
+	for outerIndex, outerPoint := range outlinePoints[1:] {
+		for innerIndex, innerPoint := range outlinePoints[0:outerIndex] {
+			if outerPoint == innerPoint {
+				return [2]int{innerIndex, outerIndex + 1}
+			}
+		}
+	}
+
+	return [2]int{}
+}
+
+func cleanUpPolygonOutlineQuadratic(outlinePoints [][2]int) [][][2]int {
+	purgedOutlines := [][][2]int{}
+
+	for {
+		overlapPoints := findOutlineOverlapQuadratic(outlinePoints)
+		if overlapPoints == [2]int{} {
+			break
+		}
+
+		newOutline := [][2]int{}
+		newOutline = append(newOutline, outlinePoints[:overlapPoints[0]]...)
+		newOutline = append(newOutline, outlinePoints[overlapPoints[1]:]...)
+
+		newPurge := [][2]int{}
+		newPurge = append(newPurge, outlinePoints[overlapPoints[0]:overlapPoints[1]]...)
+		if len(newPurge) > 2 {
+			purgedOutlines = append(purgedOutlines, newPurge)
+		}
+
+		outlinePoints = newOutline
+	}
+
+	return append([][][2]int{outlinePoints}, purgedOutlines...)
+}
+
+/*
+ *  A random walk (including diagonal steps and staying put) on a small grid,
+ *  so that it crosses itself a lot
+ */
+func getRandomOutline(random *rand.Rand, pointCount, gridSize int) [][2]int {
+	outlinePoints := [][2]int{{gridSize / 2, gridSize / 2}}
+	for len(outlinePoints) < pointCount {
+		lastPoint := outlinePoints[len(outlinePoints)-1]
+		nextPoint := [2]int{
+			lastPoint[0] + random.Intn(3) - 1,
+			lastPoint[1] + random.Intn(3) - 1,
+		}
+		if nextPoint[0] < 0 || nextPoint[1] < 0 || nextPoint[0] >= gridSize || nextPoint[1] >= gridSize {
+			continue
+		}
+		outlinePoints = append(outlinePoints, nextPoint)
+	}
+	return outlinePoints
+}
+
+func TestFindOutlineOverlapMatchesQuadratic(t *testing.T) {
+	random := rand.New(rand.NewSource(7))
+
+	for index := 0; index < 500; index++ {
+		outlinePoints := getRandomOutline(random, 2+random.Intn(30), 2+random.Intn(8))
+
+		results := FindOutlineOverlap(outlinePoints)
+		expected := findOutlineOverlapQuadratic(outlinePoints)
+
+		if results != expected {
+			t.Errorf("For %v\n Expected %v, but got %v", outlinePoints, expected, results)
+			return
+		}
+	}
+}
+
+func TestCleanUpPolygonOutlineMatchesQuadratic(t *testing.T) {
+	random := rand.New(rand.NewSource(7))
+
+	for index := 0; index < 500; index++ {
+		outlinePoints := getRandomOutline(random, 2+random.Intn(40), 2+random.Intn(8))
+
+		results := CleanUpPolygonOutline(outlinePoints, [][][2]int{}, 0)
+		expected := cleanUpPolygonOutlineQuadratic(outlinePoints)
+
+		err := comparePolygonPointsSlices(results, expected)
+		if err != "" {
+			t.Errorf("For %v\n Cleaned up Polygons. %s", outlinePoints, err)
+			return
+		}
+	}
+}
+
 /*
  * |   |   | X | X | X |
  * | X | X | X | 1 | 2 |
@@ -838,20 +1052,24 @@ func TestGetPolygonsFromCell(t *testing.T) {
 	var s ShapeExtractor
 	s.Init(getColorGrid())
 
-	s.grid[1][1] = [4]uint8{9, 9, 9, 9}
-	s.grid[2][1] = [4]uint8{9, 9, 9, 9}
-	s.alreadyDone[0][2] = true
-	s.alreadyDone[0][1] = true
-	s.alreadyDone[2][0] = true
-	s.alreadyDone[3][0] = true
-	s.alreadyDone[4][0] = true
-	s.alreadyDone[4][3] = true
+	s.setColor(1, 1, [4]uint8{9, 9, 9, 9})
+	s.setColor(2, 1, [4]uint8{9, 9, 9, 9})
+	s.setDone(0, 2)
+	s.setDone(0, 1)
+	s.setDone(2, 0)
+	s.setDone(3, 0)
+	s.setDone(4, 0)
+	s.setDone(4, 3)
 
 	colX := 3
 	rowY := 1
 	direction := 2
 
-	results := s.GetPolygonsFromCell(colX, rowY, direction, [4]uint8{1, 1, 1, 1})
+	results, polygonsErr := s.GetPolygonsFromCell(colX, rowY, direction, [4]uint8{1, 1, 1, 1})
+	if polygonsErr != nil {
+		t.Errorf("Unexpected error: %v", polygonsErr)
+		return
+	}
 	expected := [][][2]int{
 		{
 			{3, 1},
@@ -880,23 +1098,27 @@ func TestGetPolygonsFromCellComplicated(t *testing.T) {
 	var s ShapeExtractor
 	s.Init(getColorGrid())
 
-	s.grid[1][0] = [4]uint8{9, 9, 9, 9}
-	s.grid[1][1] = [4]uint8{9, 9, 9, 9}
-	s.grid[1][2] = [4]uint8{9, 9, 9, 9}
-	s.alreadyDone[0][1] = true
-	s.alreadyDone[0][2] = true
-	s.alreadyDone[2][0] = true
-	s.alreadyDone[3][0] = true
-	s.alreadyDone[4][0] = true
-	s.alreadyDone[3][2] = true
-	s.alreadyDone[4][2] = true
-	s.alreadyDone[4][3] = true
+	s.setColor(1, 0, [4]uint8{9, 9, 9, 9})
+	s.setColor(1, 1, [4]uint8{9, 9, 9, 9})
+	s.setColor(1, 2, [4]uint8{9, 9, 9, 9})
+	s.setDone(0, 1)
+	s.setDone(0, 2)
+	s.setDone(2, 0)
+	s.setDone(3, 0)
+	s.setDone(4, 0)
+	s.setDone(3, 2)
+	s.setDone(4, 2)
+	s.setDone(4, 3)
 
 	colX := 2
 	rowY := 1
 	direction := 2
 
-	results := s.GetPolygonsFromCell(colX, rowY, direction, [4]uint8{1, 1, 1, 1})
+	results, polygonsErr := s.GetPolygonsFromCell(colX, rowY, direction, [4]uint8{1, 1, 1, 1})
+	if polygonsErr != nil {
+		t.Errorf("Unexpected error: %v", polygonsErr)
+		return
+	}
 	expected := [][][2]int{
 		{
 			{2, 1},
@@ -930,8 +1152,6 @@ func TestProcessAllPolygons(t *testing.T) {
 	var s ShapeExtractor
 	s.Init(getColorGrid())
 
-	expectedDone := s.alreadyDone
-
 	// Color the B cells
 	BColRows := [][]int{
 		{},
@@ -943,7 +1163,7 @@ func TestProcessAllPolygons(t *testing.T) {
 
 	for colIndex, nextCol := range BColRows {
 		for _, nextRow := range nextCol {
-			s.grid[colIndex][nextRow] = [4]uint8{2, 2, 2, 2}
+			s.setColor(colIndex, nextRow, [4]uint8{2, 2, 2, 2})
 		}
 	}
 
@@ -958,7 +1178,7 @@ func TestProcessAllPolygons(t *testing.T) {
 
 	for colIndex, nextCol := range CColRows {
 		for _, nextRow := range nextCol {
-			s.grid[colIndex][nextRow] = [4]uint8{3, 3, 3, 3}
+			s.setColor(colIndex, nextRow, [4]uint8{3, 3, 3, 3})
 		}
 	}
 
@@ -999,10 +1219,14 @@ func TestProcessAllPolygons(t *testing.T) {
 		return
 	}
 
-	resultsDone := s.alreadyDone
-	expectedDone[1] = []bool{false, true, true, false}
-	expectedDone[2] = []bool{true, true, true, false}
-	expectedDone[3] = []bool{true, true, true, false}
+	resultsDone := getDoneGrid(&s)
+	expectedDone := [][]bool{
+		{true, true, true, true}, //  column 0
+		{true, true, true, true},
+		{true, true, true, true},
+		{true, true, true, true},
+		{true, false, true, true},
+	}
 
 	err = compareBoolGrids(resultsDone, expectedDone)
 	if err != "" {
@@ -1023,14 +1247,14 @@ func TestGetAllShapes(t *testing.T) {
 	s.Init(getColorGrid())
 
 	// Color B cell
-	s.grid[0][0] = [4]uint8{2, 2, 2, 2}
+	s.setColor(0, 0, [4]uint8{2, 2, 2, 2})
 
 	// Color C cells
-	s.grid[0][2] = [4]uint8{3, 3, 3, 3}
-	s.grid[0][3] = [4]uint8{3, 3, 3, 3}
-	s.grid[1][3] = [4]uint8{3, 3, 3, 3}
-	s.grid[4][2] = [4]uint8{3, 3, 3, 3}
-	s.grid[4][3] = [4]uint8{3, 3, 3, 3}
+	s.setColor(0, 2, [4]uint8{3, 3, 3, 3})
+	s.setColor(0, 3, [4]uint8{3, 3, 3, 3})
+	s.setColor(1, 3, [4]uint8{3, 3, 3, 3})
+	s.setColor(4, 2, [4]uint8{3, 3, 3, 3})
+	s.setColor(4, 3, [4]uint8{3, 3, 3, 3})
 
 	allPolygons, allLines := s.GetAllShapes()
 
@@ -1097,22 +1321,22 @@ func TestGetSVGText(t *testing.T) {
 	s.Init(getColorGrid())
 
 	// Color B cell
-	s.grid[0][0] = [4]uint8{2, 2, 222, 2}
+	s.setColor(0, 0, [4]uint8{2, 2, 222, 2})
 
 	// Color C cells
-	s.grid[0][2] = [4]uint8{223, 3, 3, 3}
-	s.grid[0][3] = [4]uint8{223, 3, 3, 3}
-	s.grid[1][3] = [4]uint8{223, 3, 3, 3}
-	s.grid[4][2] = [4]uint8{223, 3, 3, 3}
-	s.grid[4][3] = [4]uint8{223, 3, 3, 3}
+	s.setColor(0, 2, [4]uint8{223, 3, 3, 3})
+	s.setColor(0, 3, [4]uint8{223, 3, 3, 3})
+	s.setColor(1, 3, [4]uint8{223, 3, 3, 3})
+	s.setColor(4, 2, [4]uint8{223, 3, 3, 3})
+	s.setColor(4, 3, [4]uint8{223, 3, 3, 3})
 
 	results := s.GetSVGText()
-	expected := `<svg width="5" height="4">
+	expected := `<svg xmlns="http://www.w3.org/2000/svg" width="5" height="4" viewBox="-0.5 -0.5 5 4">
  <g>
   <polygon class="#010101" points="1,0 4,0 4,1 3,2 3,3 2,3 1,2 0,1 " stroke="#010101" fill="#010101" />
   <polygon class="#DF0303" points="0,2 1,3 0,3 " stroke="#DF0303" fill="#DF0303" />
-  <line class="#0202DE" x1="0" y1="0" x2="0" y2="0" stroke="#0202DE" fill="#0202DE" />
-  <line class="#DF0303" x1="4" y1="2" x2="4" y2="3" stroke="#DF0303" fill="#DF0303" />
+  <rect class="#0202DE" x="-0.5" y="-0.5" width="1" height="1" fill="#0202DE" />
+  <rect class="#DF0303" x="3.5" y="1.5" width="1" height="2" fill="#DF0303" />
  </g>
 </svg>`
 
@@ -1133,14 +1357,14 @@ func TestGetSVGTextLarge(t *testing.T) {
 	s.Init(gridColors)
 
 	results := s.GetSVGText()
-	expected := `<svg width="18" height="12">
+	expected := `<svg xmlns="http://www.w3.org/2000/svg" width="18" height="12" viewBox="-0.5 -0.5 18 12">
  <g>
   <polygon class="#EB0000" points="0,0 5,0 5,11 0,11 0,1 " stroke="#EB0000" fill="#EB0000" />
   <polygon class="#EBEB00" points="6,0 11,0 11,6 6,1 " stroke="#EBEB00" fill="#EBEB00" />
   <polygon class="#00B43C" points="12,0 17,0 17,11 12,11 12,1 " stroke="#00B43C" fill="#00B43C" />
   <polygon class="#0000DC" points="6,2 11,7 11,11 6,11 6,3 " stroke="#0000DC" fill="#0000DC" />
   <polygon class="#EB0000" points="14,4 15,4 15,7 14,7 14,6 14,5 " stroke="#EB0000" fill="#EB0000" />
-  <line class="#0000DC" x1="3" y1="4" x2="3" y2="7" stroke="#0000DC" fill="#0000DC" />
+  <rect class="#0000DC" x="2.5" y="3.5" width="1" height="4" fill="#0000DC" />
  </g>
 </svg>`
 
@@ -1151,7 +1375,7 @@ func TestGetSVGTextLarge(t *testing.T) {
 }
 
 /*
- *  Manually check the file that has been written
+ *  The file gets the same svg as GetSVGText
  */
 func TestWriteSVGToFile(t *testing.T) {
 	var s ShapeExtractor
@@ -1159,7 +1383,19 @@ func TestWriteSVGToFile(t *testing.T) {
 	gridColors := getBigColorGrid()
 	s.Init(gridColors)
 
-	s.WriteSVGToFile("test_svg_output.xml")
+	filePath := filepath.Join(t.TempDir(), "test_svg_output.xml")
+	if err := s.WriteSVGToFile(filePath); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	results, err := os.ReadFile(filePath)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	s.Init(gridColors)
+	if expected := s.GetSVGText(); string(results) != expected {
+		t.Errorf("Expected the file to have\n%s\n but got\n%s", expected, results)
+	}
 }
 
 func TestGetIndexOfLastRepeatDirectionWhole(t *testing.T) {
@@ -1528,3 +1764,221 @@ func TestReducePolygonOutlineComplicated(t *testing.T) {
 		t.Errorf("Reduced Polygon (multi pass) outline. %s", err)
 	}
 }
+
+/*
+ *     0   1   2   3   4
+ * 0 | T | T | T | T | T |
+ * 1 | T | H | H | T | T |
+ * 2 | T | H | H | T | S |
+ * 3 | T | T | T | T | T |
+ *
+ * T is transparent, H is half transparent and S is solid
+ */
+func TestGetSVGTextUseAlpha(t *testing.T) {
+	var s ShapeExtractor
+	colorGrid := getColorGrid()
+	for _, nextCol := range colorGrid {
+		for rowY := range nextCol {
+			nextCol[rowY] = [4]uint8{200, 200, 200, 0}
+		}
+	}
+	s.Init(colorGrid)
+	s.UseAlpha = true
+
+	s.setColor(1, 1, [4]uint8{5, 5, 5, 128})
+	s.setColor(2, 1, [4]uint8{5, 5, 5, 128})
+	s.setColor(1, 2, [4]uint8{5, 5, 5, 128})
+	s.setColor(2, 2, [4]uint8{5, 5, 5, 128})
+	s.setColor(4, 2, [4]uint8{7, 7, 7, 255})
+
+	results := s.GetSVGText()
+	expected := `<svg xmlns="http://www.w3.org/2000/svg" width="5" height="4" viewBox="-0.5 -0.5 5 4">
+ <g>
+  <polygon class="#050505" points="1,1 2,1 2,2 1,2 " stroke="#050505" fill="#050505" stroke-opacity="0.502" fill-opacity="0.502" />
+  <rect class="#070707" x="3.5" y="1.5" width="1" height="1" fill="#070707" />
+ </g>
+</svg>`
+
+	if results != expected {
+		t.Errorf("\nExpected \n%s, \nbut got \n%s", expected, results)
+		return
+	}
+}
+
+/*
+ *     0   1   2   3
+ * 0 | R | R | R | R |
+ * 1 | R | T | T | R |
+ * 2 | R | T | T | R |
+ * 3 | R | R | R | R |
+ *
+ * R is red and T is transparent. The transparent center has to be
+ * a hole, so that it isn't covered by the ring.
+ */
+func TestGetSVGTextUseAlphaEnclosedTransparency(t *testing.T) {
+	red := [4]uint8{200, 0, 0, 255}
+	clear := [4]uint8{0, 0, 0, 0}
+	colorGrid := [][][4]uint8{
+		{red, red, red, red},     // Column 0
+		{red, clear, clear, red}, // Column 1
+		{red, clear, clear, red}, // Column 2
+		{red, red, red, red},     // Column 3
+	}
+
+	var s ShapeExtractor
+	s.Init(colorGrid)
+	s.UseAlpha = true
+
+	allPolygons, allLines := s.GetAllShapes()
+	expected := []Polygon{
+		{
+			ColorRGBA: red,
+			Points:    [][2]int{{0, 0}, {4, 0}, {4, 4}, {0, 4}},
+			Holes:     [][][2]int{{{1, 1}, {1, 3}, {3, 3}, {3, 1}}},
+		},
+	}
+	if err := comparePolygons(allPolygons, expected); err != "" {
+		t.Errorf("Polygons. %s", err)
+	}
+	if len(allLines) != 0 {
+		t.Errorf("Expected no lines, but got %v", allLines)
+	}
+
+	s.Init(colorGrid)
+	results := s.GetSVGText()
+	expectedSVG := `<svg xmlns="http://www.w3.org/2000/svg" width="4" height="4" viewBox="0 0 4 4">
+ <g>
+  <path class="#C80000" d="M0,0 L4,0 L4,4 L0,4 Z M1,1 L1,3 L3,3 L3,1 Z " fill-rule="evenodd" fill="#C80000" />
+ </g>
+</svg>`
+	if results != expectedSVG {
+		t.Errorf("\nExpected \n%s, \nbut got \n%s", expectedSVG, results)
+	}
+}
+
+func TestGetOpacity(t *testing.T) {
+	alphas := []uint8{0, 51, 128, 255}
+	expected := []string{"0", "0.2", "0.502", "1"}
+
+	results := []string{}
+	for _, nextAlpha := range alphas {
+		results = append(results, GetOpacity([4]uint8{1, 2, 3, nextAlpha}))
+	}
+
+	err := compareSliceofStrings(results, expected)
+	if err != "" {
+		t.Errorf("Opacities. %s", err)
+	}
+}
+
+/*
+ * A 3 x 3 square of slightly different greens inside a red border
+ */
+func TestProcessAllPolygonsColorTolerance(t *testing.T) {
+	red := [4]uint8{200, 0, 0, 255}
+	colorGrid := [][][4]uint8{}
+	for colX := 0; colX < 5; colX++ {
+		nextCol := [][4]uint8{}
+		for rowY := 0; rowY < 5; rowY++ {
+			nextColor := red
+			if colX > 0 && colX < 4 && rowY > 0 && rowY < 4 {
+				nextColor = [4]uint8{0, uint8(150 + colX + rowY), 0, 255}
+			}
+			nextCol = append(nextCol, nextColor)
+		}
+		colorGrid = append(colorGrid, nextCol)
+	}
+
+	var s ShapeExtractor
+	s.Init(colorGrid)
+	s.ColorTolerance = 2
+	s.ColorDistance = DeltaE2000Distance
+
+	results := s.ProcessAllPolygons()
+	expected := []Polygon{
+		{
+			ColorRGBA: red,
+			Points:    [][2]int{{0, 0}, {4, 0}, {4, 4}, {0, 4}, {0, 1}},
+		},
+		{
+			ColorRGBA: [4]uint8{0, 152, 0, 255},
+			Points:    [][2]int{{1, 1}, {3, 1}, {3, 3}, {1, 3}, {1, 2}},
+		},
+	}
+
+	err := comparePolygons(results, expected)
+	if err != "" {
+		t.Errorf("\nSeed color. %s", err)
+	}
+
+	s.Init(colorGrid)
+	s.RegionColor = MeanColor
+	results = s.ProcessAllPolygons()
+	expected[1].ColorRGBA = [4]uint8{0, 154, 0, 255}
+
+	err = comparePolygons(results, expected)
+	if err != "" {
+		t.Errorf("\nMean color. %s", err)
+	}
+}
+
+/*
+ *    0  1  2
+ *  0 a  a  a
+ *  1 x  b  x
+ *  2 x  b  x
+ *
+ * The outline goes down the spur of b's and back up, through the same
+ * cells twice, but each cell is only counted once for the mean color
+ */
+func TestProcessAllPolygonsMeanColorSpur(t *testing.T) {
+	a := [4]uint8{100, 0, 0, 255}
+	b := [4]uint8{120, 0, 0, 255}
+	x := [4]uint8{0, 0, 200, 255}
+	colorGrid, _ := GetColorGridFromRows([][][4]uint8{
+		{a, a, a}, // Row 0
+		{x, b, x}, // Row 1
+		{x, b, x}, // Row 2
+	})
+
+	var s ShapeExtractor
+	s.Init(colorGrid)
+	s.ColorTolerance = 30
+	s.RegionColor = MeanColor
+
+	results := s.ProcessAllPolygons()
+	if len(results) == 0 {
+		t.Fatalf("Expected a polygon, but got none")
+	}
+
+	expected := [4]uint8{108, 0, 0, 255}
+	if results[0].ColorRGBA != expected {
+		t.Errorf("Expected the mean color %v, but got %v for %v", expected, results[0].ColorRGBA, results[0].Points)
+	}
+}
+
+/*
+ *    0  1  2
+ *  0 c  c  b
+ *  1 a  b  c
+ *  2 b  a  d
+ *
+ * With the tolerance, the walk from the d at the bottom right goes round
+ * the a's and c's without ever getting back to it, since the cells
+ * before it that are close to it aren't done. It has to stop, leaving
+ * the cells for the lines.
+ */
+func TestConvertColorToleranceOutlineLoop(t *testing.T) {
+	a := [4]uint8{160, 80, 135, 255}
+	b := [4]uint8{0, 0, 255, 255}
+	c := [4]uint8{80, 40, 195, 255}
+	d := [4]uint8{120, 60, 165, 255}
+
+	result, err := Convert([][][4]uint8{{c, a, b}, {c, b, a}, {b, c, d}}, Config{ColorTolerance: 60})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(result.Polygons) != 0 || len(result.Lines) != 4 {
+		t.Errorf("Expected 0 polygons and 4 lines, but got %v and %v", result.Polygons, result.Lines)
+	}
+}
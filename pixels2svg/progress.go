@@ -0,0 +1,68 @@
+package pixels2svg
+
+/*
+ * Progress
+ *
+ * Set OnProgress to follow a long conversion, e.g. for a progress bar.
+ * It's called after each row of the grid is scanned and the first time
+ * each phase is entered during a scan, on the goroutine doing the
+ * conversion. The outline of every polygon goes through cleanup and
+ * reduction while the grid is scanned, so those phases are only reported
+ * once per scan rather than for every polygon.
+ */
+
+type Phase int
+
+const (
+	PhaseTracing   Phase = iota // Scanning the grid and tracing the shapes
+	PhaseCleanup                // Splitting an outline where it overlaps itself
+	PhaseReduction              // Dropping the points an outline doesn't need
+	PhaseRendering              // Writing the svg once all the shapes are found
+)
+
+type Progress struct {
+	Phase Phase
+
+	// Rows scanned so far, out of RowsToScan. When tracing through the pixel
+	// centers, the grid is scanned twice: for polygons and then for lines.
+	RowsScanned int
+	RowsToScan  int
+
+	PolygonsFound   int
+	LinesFound      int
+	RectanglesFound int
+}
+
+func (s *ShapeExtractor) reportProgress() {
+	if s.OnProgress != nil {
+		s.OnProgress(s.progress)
+	}
+}
+
+/*
+ * Start keeping track of the progress of finding all the shapes
+ */
+func (s *ShapeExtractor) resetProgress(passCount int) {
+	s.progress = Progress{RowsToScan: s.RowCount * passCount}
+	s.startPass()
+}
+
+/*
+ * Start another scan of the grid, with only the current phase reported
+ */
+func (s *ShapeExtractor) startPass() {
+	s.reportedPhases = 1 << uint(s.progress.Phase)
+}
+
+func (s *ShapeExtractor) setPhase(phase Phase) {
+	s.progress.Phase = phase
+	if s.reportedPhases&(1<<uint(phase)) == 0 {
+		s.reportedPhases |= 1 << uint(phase)
+		s.reportProgress()
+	}
+}
+
+func (s *ShapeExtractor) rowScanned() {
+	s.progress.RowsScanned++
+	s.reportProgress()
+}
@@ -0,0 +1,77 @@
+package pixels2svg
+
+import (
+	"testing"
+)
+
+func TestOnProgress(t *testing.T) {
+	allReports := []Progress{}
+	config := Config{
+		OnProgress: func(progress Progress) {
+			allReports = append(allReports, progress)
+		},
+	}
+
+	result, err := Convert(getBigColorGrid(), config)
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+		return
+	}
+
+	phaseCounts := map[Phase]int{}
+	rowsScanned := 0
+	for index, nextReport := range allReports {
+		phaseCounts[nextReport.Phase]++
+		if nextReport.RowsScanned < rowsScanned {
+			t.Errorf("Report %d. Expected rows scanned to be at least %d, but got %d", index, rowsScanned, nextReport.RowsScanned)
+		}
+		rowsScanned = nextReport.RowsScanned
+	}
+
+	for _, phase := range []Phase{PhaseTracing, PhaseCleanup, PhaseReduction, PhaseRendering} {
+		if phaseCounts[phase] == 0 {
+			t.Errorf("Expected a report for phase %d", phase)
+		}
+	}
+
+	// Only reported once for the scan, not for each polygon
+	for _, phase := range []Phase{PhaseCleanup, PhaseReduction, PhaseRendering} {
+		if phaseCounts[phase] != 1 {
+			t.Errorf("Expected 1 report for phase %d, but got %d", phase, phaseCounts[phase])
+		}
+	}
+
+	expected := Progress{
+		Phase:         PhaseRendering,
+		RowsScanned:   24, // Once for polygons and once for lines
+		RowsToScan:    24,
+		PolygonsFound: len(result.Polygons),
+		LinesFound:    len(result.Lines),
+	}
+	lastReport := allReports[len(allReports)-1]
+	if lastReport != expected {
+		t.Errorf("Expected the last report to be %+v, but got %+v", expected, lastReport)
+	}
+}
+
+func TestOnProgressRectangles(t *testing.T) {
+	var lastReport Progress
+	config := Config{
+		Strategy: Rectangles,
+		OnProgress: func(progress Progress) {
+			lastReport = progress
+		},
+	}
+
+	result, _ := Convert(getBigColorGrid(), config)
+
+	expected := Progress{
+		Phase:           PhaseRendering,
+		RowsScanned:     12,
+		RowsToScan:      12,
+		RectanglesFound: len(result.Rectangles),
+	}
+	if lastReport != expected {
+		t.Errorf("Expected the last report to be %+v, but got %+v", expected, lastReport)
+	}
+}
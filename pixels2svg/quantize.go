@@ -0,0 +1,394 @@
+package pixels2svg
+
+import (
+	"fmt"
+	"sort"
+)
+
+/*
+ * Color quantization
+ *
+ * Photos and anti-aliased images have far too many colors to turn into
+ * a sensible number of shapes. These functions reduce a grid to a small
+ * palette first. All of them treat alpha as a fourth channel, so that
+ * transparent and opaque pixels don't end up with the same color.
+ */
+
+type QuantizeMethod int
+
+const (
+	// Split the box of colors with the widest range in half (by pixel count)
+	// until there are enough boxes. Each box becomes one palette color.
+	MedianCut QuantizeMethod = iota
+
+	// Build a tree of the color bits (red, green, blue and alpha) and merge
+	// the leaves with the fewest pixels until there are few enough.
+	Octree
+
+	// Start from the median cut palette and move the palette colors to the
+	// middle of the colors closest to them (in CIELAB), until they settle.
+	KMeans
+)
+
+const kMeansMaxIterations = 20
+
+type colorCount struct {
+	color [4]uint8
+	count int
+}
+
+/*
+ * Get each color of the grid with the number of cells it has,
+ * in the order they're first found (column by column)
+ */
+func getColorCounts(colorGrid [][][4]uint8) []colorCount {
+	indexes := map[[4]uint8]int{}
+	allCounts := []colorCount{}
+
+	for _, nextCol := range colorGrid {
+		for _, nextColor := range nextCol {
+			index, found := indexes[nextColor]
+			if !found {
+				index = len(allCounts)
+				indexes[nextColor] = index
+				allCounts = append(allCounts, colorCount{color: nextColor})
+			}
+			allCounts[index].count++
+		}
+	}
+
+	return allCounts
+}
+
+/*
+ * The average of the colors, weighted by their counts
+ */
+func getMeanColor(colorCounts []colorCount) [4]uint8 {
+	sums := [4]int{}
+	total := 0
+	for _, next := range colorCounts {
+		for channel := 0; channel < 4; channel++ {
+			sums[channel] += int(next.color[channel]) * next.count
+		}
+		total += next.count
+	}
+
+	meanColor := [4]uint8{}
+	if total == 0 {
+		return meanColor
+	}
+	for channel := 0; channel < 4; channel++ {
+		meanColor[channel] = uint8((sums[channel] + total/2) / total)
+	}
+	return meanColor
+}
+
+/*
+ * Get the channel (0-3 for red, green, blue, alpha) with the widest
+ * range of values in the box, and that range
+ */
+func getWidestChannel(box []colorCount) (int, int) {
+	widestChannel := 0
+	widestRange := -1
+
+	for channel := 0; channel < 4; channel++ {
+		low, high := 255, 0
+		for _, next := range box {
+			value := int(next.color[channel])
+			if value < low {
+				low = value
+			}
+			if value > high {
+				high = value
+			}
+		}
+		if high-low > widestRange {
+			widestChannel = channel
+			widestRange = high - low
+		}
+	}
+
+	return widestChannel, widestRange
+}
+
+func getMedianCutPalette(colorCounts []colorCount, paletteSize int) [][4]uint8 {
+	boxes := [][]colorCount{append([]colorCount{}, colorCounts...)}
+
+	for len(boxes) < paletteSize {
+		boxIndex := -1
+		splitChannel := 0
+		widestRange := 0
+		for index, box := range boxes {
+			channel, channelRange := getWidestChannel(box)
+			if len(box) > 1 && channelRange > widestRange {
+				boxIndex = index
+				splitChannel = channel
+				widestRange = channelRange
+			}
+		}
+		if boxIndex < 0 {
+			break // Every box has just one color
+		}
+
+		box := boxes[boxIndex]
+		sort.SliceStable(box, func(index1, index2 int) bool {
+			return box[index1].color[splitChannel] < box[index2].color[splitChannel]
+		})
+
+		total := 0
+		for _, next := range box {
+			total += next.count
+		}
+
+		// Split where half the pixels are on each side, but keep at least
+		// one color in each half
+		splitIndex := len(box) - 1
+		runningCount := 0
+		for index, next := range box[:len(box)-1] {
+			runningCount += next.count
+			if runningCount*2 >= total {
+				splitIndex = index + 1
+				break
+			}
+		}
+
+		boxes[boxIndex] = box[:splitIndex]
+		boxes = append(boxes, box[splitIndex:])
+	}
+
+	palette := [][4]uint8{}
+	for _, box := range boxes {
+		palette = append(palette, getMeanColor(box))
+	}
+	return palette
+}
+
+type octreeNode struct {
+	colorCounts []colorCount // All the colors below this node
+	children    [16]*octreeNode
+	isLeaf      bool
+}
+
+func getOctreeChildIndex(colorRGBA [4]uint8, level int) int {
+	shift := uint(7 - level)
+	return int(colorRGBA[0]>>shift&1)<<3 |
+		int(colorRGBA[1]>>shift&1)<<2 |
+		int(colorRGBA[2]>>shift&1)<<1 |
+		int(colorRGBA[3]>>shift&1)
+}
+
+func getNodePixelCount(node *octreeNode) int {
+	total := 0
+	for _, next := range node.colorCounts {
+		total += next.count
+	}
+	return total
+}
+
+func getOctreePalette(colorCounts []colorCount, paletteSize int) [][4]uint8 {
+	root := &octreeNode{}
+	levels := make([][]*octreeNode, 8) // Nodes that aren't leaves, by level
+	levels[0] = []*octreeNode{root}
+	leafCount := 0
+
+	for _, next := range colorCounts {
+		node := root
+		node.colorCounts = append(node.colorCounts, next)
+		for level := 0; level < 8; level++ {
+			childIndex := getOctreeChildIndex(next.color, level)
+			child := node.children[childIndex]
+			if child == nil {
+				child = &octreeNode{}
+				node.children[childIndex] = child
+				if level == 7 {
+					child.isLeaf = true
+					leafCount++
+				} else {
+					levels[level+1] = append(levels[level+1], child)
+				}
+			}
+			child.colorCounts = append(child.colorCounts, next)
+			node = child
+		}
+	}
+
+	// Merge the deepest nodes with the fewest pixels into leaves
+	for level := 7; level >= 0 && leafCount > paletteSize; level-- {
+		nodes := levels[level]
+		sort.SliceStable(nodes, func(index1, index2 int) bool {
+			return getNodePixelCount(nodes[index1]) < getNodePixelCount(nodes[index2])
+		})
+
+		for _, node := range nodes {
+			if leafCount <= paletteSize {
+				break
+			}
+			childCount := 0
+			for _, child := range node.children {
+				if child != nil {
+					childCount++
+				}
+			}
+			node.children = [16]*octreeNode{}
+			node.isLeaf = true
+			leafCount -= childCount - 1
+		}
+	}
+
+	palette := [][4]uint8{}
+	nodeStack := []*octreeNode{root}
+	for len(nodeStack) > 0 {
+		node := nodeStack[len(nodeStack)-1]
+		nodeStack = nodeStack[:len(nodeStack)-1]
+		if node.isLeaf {
+			palette = append(palette, getMeanColor(node.colorCounts))
+			continue
+		}
+		for index := 15; index >= 0; index-- {
+			if node.children[index] != nil {
+				nodeStack = append(nodeStack, node.children[index])
+			}
+		}
+	}
+	return palette
+}
+
+/*
+ * A color in CIELAB, with alpha scaled to the same range as L* (0-100)
+ */
+func getQuantizeFeatures(colorRGBA [4]uint8) [4]float64 {
+	lab := rgbToLab(colorRGBA)
+	return [4]float64{lab[0], lab[1], lab[2], float64(colorRGBA[3]) * 100 / 255}
+}
+
+func getFeatureDistanceSquared(features1, features2 [4]float64) float64 {
+	total := 0.0
+	for index := 0; index < 4; index++ {
+		difference := features1[index] - features2[index]
+		total += difference * difference
+	}
+	return total
+}
+
+func getNearestFeaturesIndex(features [4]float64, allFeatures [][4]float64) int {
+	nearestIndex := 0
+	nearestDistance := -1.0
+	for index, nextFeatures := range allFeatures {
+		distance := getFeatureDistanceSquared(features, nextFeatures)
+		if nearestDistance < 0 || distance < nearestDistance {
+			nearestIndex = index
+			nearestDistance = distance
+		}
+	}
+	return nearestIndex
+}
+
+func getKMeansPalette(colorCounts []colorCount, paletteSize int) [][4]uint8 {
+	centers := [][4]float64{}
+	for _, nextColor := range getMedianCutPalette(colorCounts, paletteSize) {
+		centers = append(centers, getQuantizeFeatures(nextColor))
+	}
+
+	allFeatures := make([][4]float64, len(colorCounts))
+	for index, next := range colorCounts {
+		allFeatures[index] = getQuantizeFeatures(next.color)
+	}
+
+	for iteration := 0; iteration < kMeansMaxIterations; iteration++ {
+		sums := make([][4]float64, len(centers))
+		totals := make([]float64, len(centers))
+
+		for index, features := range allFeatures {
+			centerIndex := getNearestFeaturesIndex(features, centers)
+			count := float64(colorCounts[index].count)
+			for channel := 0; channel < 4; channel++ {
+				sums[centerIndex][channel] += features[channel] * count
+			}
+			totals[centerIndex] += count
+		}
+
+		hasMoved := false
+		for centerIndex := range centers {
+			if totals[centerIndex] == 0 {
+				continue // Nothing closest to it, so leave it where it is
+			}
+			newCenter := [4]float64{}
+			for channel := 0; channel < 4; channel++ {
+				newCenter[channel] = sums[centerIndex][channel] / totals[centerIndex]
+			}
+			if getFeatureDistanceSquared(newCenter, centers[centerIndex]) > 0.0001 {
+				hasMoved = true
+			}
+			centers[centerIndex] = newCenter
+		}
+		if !hasMoved {
+			break
+		}
+	}
+
+	palette := [][4]uint8{}
+	for _, center := range centers {
+		alpha := uint8(center[3]*255/100 + 0.5)
+		palette = append(palette, labToRGB([3]float64{center[0], center[1], center[2]}, alpha))
+	}
+	return palette
+}
+
+/*
+ * Reduce the colors of a grid to a palette with at most paletteSize colors,
+ * using the given method. Each cell gets the palette color closest to its
+ * own color (in CIELAB).
+ *
+ * Returns a new grid, ready for Init, and the palette.
+ * If the grid already has few enough colors, they are the palette.
+ */
+func QuantizeColorGrid(
+	colorGrid [][][4]uint8,
+	method QuantizeMethod,
+	paletteSize int,
+) ([][][4]uint8, [][4]uint8, error) {
+
+	if paletteSize < 1 {
+		return nil, nil, fmt.Errorf("palette size must be at least 1, got %d", paletteSize)
+	}
+
+	colorCounts := getColorCounts(colorGrid)
+	palette := [][4]uint8{}
+
+	switch {
+	case len(colorCounts) <= paletteSize:
+		for _, next := range colorCounts {
+			palette = append(palette, next.color)
+		}
+	case method == MedianCut:
+		palette = getMedianCutPalette(colorCounts, paletteSize)
+	case method == Octree:
+		palette = getOctreePalette(colorCounts, paletteSize)
+	case method == KMeans:
+		palette = getKMeansPalette(colorCounts, paletteSize)
+	default:
+		return nil, nil, fmt.Errorf("unknown quantize method: %d", method)
+	}
+
+	paletteFeatures := [][4]float64{}
+	for _, nextColor := range palette {
+		paletteFeatures = append(paletteFeatures, getQuantizeFeatures(nextColor))
+	}
+
+	newColors := make(map[[4]uint8][4]uint8, len(colorCounts))
+	for _, next := range colorCounts {
+		nearestIndex := getNearestFeaturesIndex(getQuantizeFeatures(next.color), paletteFeatures)
+		newColors[next.color] = palette[nearestIndex]
+	}
+
+	newGrid := make([][][4]uint8, len(colorGrid))
+	for colX, nextCol := range colorGrid {
+		newCol := make([][4]uint8, len(nextCol))
+		for rowY, nextColor := range nextCol {
+			newCol[rowY] = newColors[nextColor]
+		}
+		newGrid[colX] = newCol
+	}
+
+	return newGrid, palette, nil
+}
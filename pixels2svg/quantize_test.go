@@ -0,0 +1,138 @@
+package pixels2svg
+
+import (
+	"testing"
+)
+
+/*
+ *  A grid that fades from black to white along the columns and
+ *  from opaque to a bit transparent along the rows
+ */
+func getGradientColorGrid() [][][4]uint8 {
+	colorGrid := [][][4]uint8{}
+	for colX := 0; colX < 64; colX++ {
+		nextCol := [][4]uint8{}
+		for rowY := 0; rowY < 8; rowY++ {
+			shade := uint8(colX * 4)
+			nextCol = append(nextCol, [4]uint8{shade, shade / 2, 255 - shade, uint8(255 - rowY)})
+		}
+		colorGrid = append(colorGrid, nextCol)
+	}
+	return colorGrid
+}
+
+func getGridColors(colorGrid [][][4]uint8) map[[4]uint8]bool {
+	allColors := map[[4]uint8]bool{}
+	for _, nextCol := range colorGrid {
+		for _, nextColor := range nextCol {
+			allColors[nextColor] = true
+		}
+	}
+	return allColors
+}
+
+func TestQuantizeColorGridMethods(t *testing.T) {
+	colorGrid := getGradientColorGrid()
+	methods := map[string]QuantizeMethod{
+		"MedianCut": MedianCut,
+		"Octree":    Octree,
+		"KMeans":    KMeans,
+	}
+
+	for name, method := range methods {
+		newGrid, palette, err := QuantizeColorGrid(colorGrid, method, 6)
+		if err != nil {
+			t.Errorf("%s. Unexpected error: %s", name, err)
+			continue
+		}
+		if len(palette) > 6 {
+			t.Errorf("%s. Expected at most 6 palette colors, but got %d", name, len(palette))
+		}
+
+		paletteColors := map[[4]uint8]bool{}
+		for _, nextColor := range palette {
+			paletteColors[nextColor] = true
+		}
+		for nextColor := range getGridColors(newGrid) {
+			if !paletteColors[nextColor] {
+				t.Errorf("%s. Color %v of the new grid isn't in the palette", name, nextColor)
+				break
+			}
+		}
+
+		if len(getGridColors(newGrid)) < 2 {
+			t.Errorf("%s. Expected the gradient to keep more than one color", name)
+		}
+	}
+}
+
+func TestQuantizeColorGridFewColors(t *testing.T) {
+	colorGrid := getColorGrid()
+	colorGrid[1][1] = [4]uint8{2, 2, 2, 2}
+
+	newGrid, palette, err := QuantizeColorGrid(colorGrid, KMeans, 2)
+	if err != nil {
+		t.Errorf("Unexpected error: %s", err)
+		return
+	}
+
+	errText := compareColorGrids(newGrid, colorGrid)
+	if errText != "" {
+		t.Errorf("Expected the grid to be unchanged. %s", errText)
+	}
+	if len(palette) != 2 || palette[0] != [4]uint8{1, 1, 1, 1} || palette[1] != [4]uint8{2, 2, 2, 2} {
+		t.Errorf("Expected the grid's own colors as the palette, but got %v", palette)
+	}
+}
+
+/*
+ * Same red, but one is transparent. They shouldn't be merged with each
+ * other, even though the other two colors are further apart in RGB.
+ */
+func TestQuantizeColorGridKeepsAlpha(t *testing.T) {
+	red := [4]uint8{200, 0, 0, 255}
+	clearRed := [4]uint8{200, 0, 0, 0}
+	blue := [4]uint8{0, 0, 200, 255}
+	darkBlue := [4]uint8{0, 0, 180, 255}
+	colorGrid := [][][4]uint8{
+		{red, red, clearRed, clearRed},
+		{blue, blue, darkBlue, darkBlue},
+	}
+
+	for _, method := range []QuantizeMethod{MedianCut, Octree, KMeans} {
+		newGrid, _, err := QuantizeColorGrid(colorGrid, method, 3)
+		if err != nil {
+			t.Errorf("Unexpected error: %s", err)
+			continue
+		}
+		if newGrid[0][0][3] != 255 || newGrid[0][2][3] != 0 {
+			t.Errorf("Method %d. Expected opaque and transparent to stay apart, but got %v", method, newGrid[0])
+		}
+		if newGrid[1][0] != newGrid[1][2] {
+			t.Errorf("Method %d. Expected the blues to be merged, but got %v", method, newGrid[1])
+		}
+	}
+}
+
+func TestQuantizeColorGridBadPaletteSize(t *testing.T) {
+	_, _, err := QuantizeColorGrid(getColorGrid(), MedianCut, 0)
+	if err == nil {
+		t.Errorf("Expected an error for a palette size of 0")
+	}
+}
+
+func TestLabRoundTrip(t *testing.T) {
+	allColors := [][4]uint8{
+		{0, 0, 0, 255},
+		{255, 255, 255, 255},
+		{12, 200, 99, 7},
+		{250, 10, 130, 128},
+	}
+
+	for _, expected := range allColors {
+		results := labToRGB(rgbToLab(expected), expected[3])
+		if results != expected {
+			t.Errorf("Expected %v, but got %v", expected, results)
+		}
+	}
+}
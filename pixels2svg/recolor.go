@@ -0,0 +1,93 @@
+package pixels2svg
+
+import "sync"
+
+/*
+ * Recoloring
+ *
+ * The shapes from GetAllShapes can be recolored, e.g. for other color
+ * schemes, without extracting them again, and then written with
+ * WriteShapesSVG. A ColorMapper gives the new color for each old one.
+ */
+
+type ColorMapper func(colorRGBA [4]uint8) [4]uint8
+
+/*
+ * Get a ColorMapper that replaces each color in colorMap with the color it
+ * maps to and leaves any other color as it is
+ */
+func MapColors(colorMap map[[4]uint8][4]uint8) ColorMapper {
+	return func(colorRGBA [4]uint8) [4]uint8 {
+		newColor, found := colorMap[colorRGBA]
+		if !found {
+			return colorRGBA
+		}
+		return newColor
+	}
+}
+
+/*
+ * Get a ColorMapper that replaces each color with the nearest color of the
+ * palette, using colorDistance (EuclideanRGBDistance if it's nil).
+ * With an empty palette, the colors stay as they are.
+ * The mapper can be used by several goroutines at the same time.
+ */
+func MapToPalette(palette [][4]uint8, colorDistance ColorDistanceFunc) ColorMapper {
+	if colorDistance == nil {
+		colorDistance = EuclideanRGBDistance
+	}
+
+	var cacheLock sync.Mutex
+	nearestColors := map[[4]uint8][4]uint8{} // Each color only needs to be looked up once
+	return func(colorRGBA [4]uint8) [4]uint8 {
+		if len(palette) == 0 {
+			return colorRGBA
+		}
+		cacheLock.Lock()
+		nearest, found := nearestColors[colorRGBA]
+		cacheLock.Unlock()
+		if found {
+			return nearest
+		}
+
+		nearest = palette[0]
+		nearestDistance := colorDistance(colorRGBA, nearest)
+		for _, nextColor := range palette[1:] {
+			distance := colorDistance(colorRGBA, nextColor)
+			if distance < nearestDistance {
+				nearest = nextColor
+				nearestDistance = distance
+			}
+		}
+
+		cacheLock.Lock()
+		nearestColors[colorRGBA] = nearest
+		cacheLock.Unlock()
+		return nearest
+	}
+}
+
+/*
+ * Get copies of the polygons with their colors mapped.
+ * The copies share their points with the originals.
+ */
+func RecolorPolygons(allPolygons []Polygon, mapColor ColorMapper) []Polygon {
+	newPolygons := make([]Polygon, len(allPolygons))
+	for index, nextPolygon := range allPolygons {
+		nextPolygon.ColorRGBA = mapColor(nextPolygon.ColorRGBA)
+		newPolygons[index] = nextPolygon
+	}
+	return newPolygons
+}
+
+/*
+ * Get copies of the lines with their colors mapped
+ */
+func RecolorLines(allLines []Line, mapColor ColorMapper) []Line {
+	newLines := make([]Line, len(allLines))
+	for index, nextLine := range allLines {
+		nextLine.ColorRGBA = mapColor(nextLine.ColorRGBA)
+		newLines[index] = nextLine
+	}
+	return newLines
+}
@@ -0,0 +1,150 @@
+package pixels2svg
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestMapColors(t *testing.T) {
+	red := [4]uint8{255, 0, 0, 255}
+	blue := [4]uint8{0, 0, 255, 255}
+	green := [4]uint8{0, 255, 0, 255}
+
+	mapColor := MapColors(map[[4]uint8][4]uint8{red: blue})
+
+	if results := mapColor(red); results != blue {
+		t.Errorf("Expected %v, but got %v", blue, results)
+	}
+	if results := mapColor(green); results != green {
+		t.Errorf("Expected %v to stay as it is, but got %v", green, results)
+	}
+}
+
+func TestMapToPalette(t *testing.T) {
+	black := [4]uint8{0, 0, 0, 255}
+	white := [4]uint8{255, 255, 255, 255}
+	red := [4]uint8{200, 30, 30, 255}
+	palette := [][4]uint8{black, white, red}
+
+	allTests := map[[4]uint8][4]uint8{
+		{10, 20, 10, 255}:    black,
+		{240, 230, 250, 255}: white,
+		{150, 50, 40, 255}:   red,
+		{200, 30, 30, 255}:   red,
+	}
+
+	mapColor := MapToPalette(palette, nil)
+	for colorRGBA, expected := range allTests {
+		results := mapColor(colorRGBA)
+		if results != expected {
+			t.Errorf("For %v, expected %v, but got %v", colorRGBA, expected, results)
+		}
+	}
+
+	unchanged := MapToPalette(nil, nil)([4]uint8{1, 2, 3, 4})
+	if unchanged != [4]uint8{1, 2, 3, 4} {
+		t.Errorf("Expected an empty palette to leave the color as it is, but got %v", unchanged)
+	}
+}
+
+/*
+ * One mapper shared by several goroutines (run with -race)
+ */
+func TestMapToPaletteConcurrent(t *testing.T) {
+	black := [4]uint8{0, 0, 0, 255}
+	white := [4]uint8{255, 255, 255, 255}
+	mapColor := MapToPalette([][4]uint8{black, white}, nil)
+
+	var waitGroup sync.WaitGroup
+	for worker := 0; worker < 4; worker++ {
+		waitGroup.Add(1)
+		go func() {
+			defer waitGroup.Done()
+			for shade := 0; shade < 256; shade++ {
+				colorRGBA := [4]uint8{uint8(shade), uint8(shade), uint8(shade), 255}
+				expected := black
+				if shade >= 128 {
+					expected = white
+				}
+				if results := mapColor(colorRGBA); results != expected {
+					t.Errorf("For %v, expected %v, but got %v", colorRGBA, expected, results)
+				}
+			}
+		}()
+	}
+	waitGroup.Wait()
+}
+
+/*
+ *    0  1  2
+ *  0 a  a  a
+ *  1 a  a  a
+ *  2 b  b  a
+ */
+func TestGetShapesSVGTextRecolored(t *testing.T) {
+	a := [4]uint8{1, 1, 1, 255}
+	b := [4]uint8{2, 2, 2, 255}
+	c := [4]uint8{3, 3, 3, 255}
+	colorGrid := [][][4]uint8{
+		{a, a, b}, // Column 0
+		{a, a, b}, // Column 1
+		{a, a, a}, // Column 2
+	}
+
+	var s ShapeExtractor
+	s.Init(colorGrid)
+	allPolygons, allLines := s.GetAllShapes()
+
+	mapColor := MapColors(map[[4]uint8][4]uint8{a: c})
+	newPolygons := RecolorPolygons(allPolygons, mapColor)
+	newLines := RecolorLines(allLines, mapColor)
+
+	if allPolygons[0].ColorRGBA != a {
+		t.Errorf("Expected the original polygon to keep color %v, but got %v", a, allPolygons[0].ColorRGBA)
+	}
+
+	results := s.GetShapesSVGText(newPolygons, newLines)
+	expected := `<svg xmlns="http://www.w3.org/2000/svg" width="3" height="3" viewBox="-0.5 -0.5 3 3">
+ <g>
+  <polygon class="#030303" points="0,0 2,0 2,2 1,1 0,1 " stroke="#030303" fill="#030303" />
+  <rect class="#020202" x="-0.5" y="1.5" width="2" height="1" fill="#020202" />
+ </g>
+</svg>`
+
+	if results != expected {
+		t.Errorf("Expected svg\n%s\nbut got\n%s", expected, results)
+	}
+}
+
+/*
+ * The rectangles come back from GetAllShapes as polygons with their
+ * coordinates on pixel corners, so they mustn't get a stroke
+ *
+ *    0  1
+ *  0 a  b
+ */
+func TestGetShapesSVGTextRectangles(t *testing.T) {
+	a := [4]uint8{1, 1, 1, 255}
+	b := [4]uint8{2, 2, 2, 255}
+	colorGrid := [][][4]uint8{
+		{a}, // Column 0
+		{b}, // Column 1
+	}
+
+	var s ShapeExtractor
+	s.Init(colorGrid)
+	s.Strategy = Rectangles
+	allPolygons, allLines := s.GetAllShapes()
+
+	results := s.GetShapesSVGText(allPolygons, allLines)
+	expected := `<svg xmlns="http://www.w3.org/2000/svg" width="2" height="1" viewBox="0 0 2 1">
+ <g>
+  <polygon class="#010101" points="0,0 1,0 1,1 0,1 " fill="#010101" />
+  <polygon class="#020202" points="1,0 2,0 2,1 1,1 " fill="#020202" />
+ </g>
+</svg>`
+
+	if results != expected {
+		t.Errorf("Expected svg\n%s\nbut got\n%s", expected, results)
+	}
+}
@@ -0,0 +1,162 @@
+package pixels2svg
+
+/*
+ * Rectangle decomposition
+ *
+ * Blocky pixel art comes out cleaner as a set of rectangles than as traced
+ * polygons. These functions cover each color region with rectangles,
+ * picking the biggest rectangle they can find at each cell, going right
+ * then down. Coordinates are on pixel corners, like with TraceEdges.
+ */
+
+type Strategy int
+
+const (
+	TraceOutlines Strategy = iota // Polygons (and lines for what's left over)
+	Rectangles                    // Rectangles that cover the grid
+)
+
+type Rectangle struct {
+	ColorRGBA [4]uint8
+	ColX      int // Left edge
+	RowY      int // Top edge
+	Width     int
+	Height    int
+}
+
+/*
+ * Get the outline of the rectangle, clockwise from its top left corner
+ */
+func (r Rectangle) GetPolygon() Polygon {
+	right := r.ColX + r.Width
+	bottom := r.RowY + r.Height
+	return Polygon{
+		ColorRGBA: r.ColorRGBA,
+		Points:    [][2]int{{r.ColX, r.RowY}, {right, r.RowY}, {right, bottom}, {r.ColX, bottom}},
+	}
+}
+
+/*
+ * Are the shapes' coordinates on pixel corners, rather than pixel centers
+ */
+func (s *ShapeExtractor) hasCornerCoordinates() bool {
+	return s.Strategy == Rectangles || s.isTracingEdges()
+}
+
+/*
+ * Is every cell of a row, from startCol for width cells, free and of
+ * a similar color
+ */
+func (s *ShapeExtractor) isRowFree(startCol, rowY, width int, color [4]uint8) bool {
+	for colX := startCol; colX < startCol+width; colX++ {
+		if s.isCellDoneOrDifferent(colX, rowY, color) {
+			return false
+		}
+	}
+	return true
+}
+
+/*
+ * Is every cell of a column, from startRow for height cells, free and of
+ * a similar color
+ */
+func (s *ShapeExtractor) isColumnFree(colX, startRow, height int, color [4]uint8) bool {
+	for rowY := startRow; rowY < startRow+height; rowY++ {
+		if s.isCellDoneOrDifferent(colX, rowY, color) {
+			return false
+		}
+	}
+	return true
+}
+
+/*
+ * Get the width and height of the biggest rectangle with its top left
+ * corner at the starting cell, trying both as wide as possible first
+ * and as tall as possible first.
+ */
+func (s *ShapeExtractor) getRectangleSize(startCol, startRow int, color [4]uint8) (int, int) {
+	// As wide as possible, then as tall as that width allows
+	wideWidth := 1
+	for startCol+wideWidth < s.ColCount && s.isColumnFree(startCol+wideWidth, startRow, 1, color) {
+		wideWidth++
+	}
+	wideHeight := 1
+	for startRow+wideHeight < s.RowCount && s.isRowFree(startCol, startRow+wideHeight, wideWidth, color) {
+		wideHeight++
+	}
+
+	// As tall as possible, then as wide as that height allows
+	tallHeight := 1
+	for startRow+tallHeight < s.RowCount && s.isRowFree(startCol, startRow+tallHeight, 1, color) {
+		tallHeight++
+	}
+	tallWidth := 1
+	for startCol+tallWidth < s.ColCount && s.isColumnFree(startCol+tallWidth, startRow, tallHeight, color) {
+		tallWidth++
+	}
+
+	if tallWidth*tallHeight > wideWidth*wideHeight {
+		return tallWidth, tallHeight
+	}
+	return wideWidth, wideHeight
+}
+
+/*
+ * Goes through the grid, cell by cell, and covers it with rectangles of
+ * the same (or a similar) color.
+ * Passes each rectangle to emit as soon as it's found and stops at the
+ * first error emit returns.
+ */
+func (s *ShapeExtractor) processRectangles(emit func(Rectangle) error) error {
+	s.prepareGrid()
+
+	for rowIndex := 0; rowIndex < s.RowCount; rowIndex++ {
+		for colIndex := 0; colIndex < s.ColCount; colIndex++ {
+			if s.isDone(colIndex, rowIndex) {
+				continue
+			}
+
+			color := s.getColor(colIndex, rowIndex)
+			width, height := s.getRectangleSize(colIndex, rowIndex, color)
+
+			s.resetColorSums()
+			for colX := colIndex; colX < colIndex+width; colX++ {
+				for rowY := rowIndex; rowY < rowIndex+height; rowY++ {
+					s.markCellDone(colX, rowY)
+				}
+			}
+
+			newRectangle := Rectangle{
+				ColorRGBA: s.getRegionColor(color),
+				ColX:      colIndex,
+				RowY:      rowIndex,
+				Width:     width,
+				Height:    height,
+			}
+			s.progress.RectanglesFound++
+			if err := emit(newRectangle); err != nil {
+				return err
+			}
+		}
+		s.rowScanned()
+		if err := s.checkContext(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+/*
+ * Goes through the grid, cell by cell, and covers it with rectangles of
+ * the same color.
+ */
+func (s *ShapeExtractor) GetAllRectangles() []Rectangle {
+	allRectangles := []Rectangle{}
+	s.processRectangles(func(nextRectangle Rectangle) error {
+		allRectangles = append(allRectangles, nextRectangle)
+		return nil
+	})
+
+	return allRectangles
+}
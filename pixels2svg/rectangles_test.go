@@ -0,0 +1,105 @@
+package pixels2svg
+
+import (
+	"testing"
+)
+
+/*
+ *     0   1   2   3   4
+ * 0 | B | A | A | A | A |
+ * 1 | A | A | A | A | A |
+ * 2 | C | A | A | A | C |
+ * 3 | C | C | A | A | C |
+ */
+func TestGetAllRectangles(t *testing.T) {
+	var s ShapeExtractor
+	s.Init(getColorGrid())
+	a := [4]uint8{1, 1, 1, 1}
+	b := [4]uint8{2, 2, 2, 2}
+	c := [4]uint8{3, 3, 3, 3}
+
+	s.setColor(0, 0, b)
+	s.setColor(0, 2, c)
+	s.setColor(0, 3, c)
+	s.setColor(1, 3, c)
+	s.setColor(4, 2, c)
+	s.setColor(4, 3, c)
+
+	results := s.GetAllRectangles()
+	expected := []Rectangle{
+		{ColorRGBA: b, ColX: 0, RowY: 0, Width: 1, Height: 1},
+		{ColorRGBA: a, ColX: 1, RowY: 0, Width: 3, Height: 3}, // Taller beats wider (4 x 2)
+		{ColorRGBA: a, ColX: 4, RowY: 0, Width: 1, Height: 2},
+		{ColorRGBA: a, ColX: 0, RowY: 1, Width: 1, Height: 1},
+		{ColorRGBA: c, ColX: 0, RowY: 2, Width: 1, Height: 2},
+		{ColorRGBA: c, ColX: 4, RowY: 2, Width: 1, Height: 2},
+		{ColorRGBA: c, ColX: 1, RowY: 3, Width: 1, Height: 1},
+		{ColorRGBA: a, ColX: 2, RowY: 3, Width: 2, Height: 1},
+	}
+
+	if len(results) != len(expected) {
+		t.Errorf("Expected %d rectangles, but got %d: %v", len(expected), len(results), results)
+		return
+	}
+	for index, nextRectangle := range results {
+		if nextRectangle != expected[index] {
+			t.Errorf("Rectangle %d. Expected %v, but got %v", index, expected[index], nextRectangle)
+		}
+	}
+}
+
+/*
+ *  The rectangles should cover every cell of the grid exactly once,
+ *  with the cell's own color
+ */
+func TestGetAllRectanglesCoversGrid(t *testing.T) {
+	var s ShapeExtractor
+	colorGrid := getBigColorGrid()
+	s.Init(colorGrid)
+
+	coverCounts := make([][]int, s.ColCount)
+	for colX := range coverCounts {
+		coverCounts[colX] = make([]int, s.RowCount)
+	}
+
+	for _, nextRectangle := range s.GetAllRectangles() {
+		for colX := nextRectangle.ColX; colX < nextRectangle.ColX+nextRectangle.Width; colX++ {
+			for rowY := nextRectangle.RowY; rowY < nextRectangle.RowY+nextRectangle.Height; rowY++ {
+				coverCounts[colX][rowY]++
+				if colorGrid[colX][rowY] != nextRectangle.ColorRGBA {
+					t.Errorf("Cell %d, %d. Expected color %v, but got %v", colX, rowY, colorGrid[colX][rowY], nextRectangle.ColorRGBA)
+				}
+			}
+		}
+	}
+
+	for colX, nextCol := range coverCounts {
+		for rowY, count := range nextCol {
+			if count != 1 {
+				t.Errorf("Cell %d, %d. Expected it covered once, but got %d", colX, rowY, count)
+			}
+		}
+	}
+}
+
+func TestGetSVGTextRectangles(t *testing.T) {
+	var s ShapeExtractor
+	s.Init([][][4]uint8{
+		{{1, 1, 1, 255}, {2, 2, 2, 255}},
+		{{1, 1, 1, 255}, {1, 1, 1, 255}},
+	})
+	s.Strategy = Rectangles
+
+	results := s.GetSVGText()
+	expected := `<svg xmlns="http://www.w3.org/2000/svg" width="2" height="2" viewBox="0 0 2 2">
+ <g>
+  <rect class="#010101" x="0" y="0" width="2" height="1" fill="#010101" />
+  <rect class="#020202" x="0" y="1" width="1" height="1" fill="#020202" />
+  <rect class="#010101" x="1" y="1" width="1" height="1" fill="#010101" />
+ </g>
+</svg>`
+
+	if results != expected {
+		t.Errorf("\nExpected \n%s, \nbut got \n%s", expected, results)
+	}
+}
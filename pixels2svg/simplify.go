@@ -0,0 +1,223 @@
+package pixels2svg
+
+import (
+	"container/heap"
+	"math"
+)
+
+/*
+ * Outline simplification
+ *
+ * ReducePolygonOutline only drops points that don't change the outline.
+ * A Simplifier may also drop points that move the outline a little, up to
+ * its Tolerance (in pixels), trading fidelity for fewer points.
+ */
+
+type Simplifier interface {
+	// Get a simplified copy of a polyline, keeping its first and last points
+	SimplifyPolyline(points [][2]int) [][2]int
+}
+
+/*
+ * Keep the point furthest from the line between the first and last points
+ * if it's further than Tolerance, then do the same on each side of it.
+ */
+type DouglasPeucker struct {
+	Tolerance float64
+}
+
+/*
+ * Repeatedly drop the point that moves the outline the least (the height of
+ * the triangle it makes with its neighbors), while that is within Tolerance.
+ */
+type VisvalingamWhyatt struct {
+	Tolerance float64
+}
+
+/*
+ * Get the distance from a point to the line segment between two others
+ */
+func getDistanceToSegment(point, segmentStart, segmentEnd [2]int) float64 {
+	start := toFloatPoint(segmentStart)
+	segment := subtractPoints(toFloatPoint(segmentEnd), start)
+	offset := subtractPoints(toFloatPoint(point), start)
+
+	lengthSquared := dotProduct(segment, segment)
+	if lengthSquared == 0 {
+		return getPointLength(offset)
+	}
+
+	t := math.Max(0, math.Min(1, dotProduct(offset, segment)/lengthSquared))
+	return getPointLength(subtractPoints(offset, scalePoint(segment, t)))
+}
+
+func (d DouglasPeucker) SimplifyPolyline(points [][2]int) [][2]int {
+	if len(points) < 3 {
+		return append([][2]int{}, points...)
+	}
+
+	keep := make([]bool, len(points))
+	keep[0] = true
+	keep[len(points)-1] = true
+
+	// Ranges of points (first and last index) still to check
+	rangeStack := [][2]int{{0, len(points) - 1}}
+	for len(rangeStack) > 0 {
+		first, last := split2Int(rangeStack[len(rangeStack)-1])
+		rangeStack = rangeStack[:len(rangeStack)-1]
+
+		furthestIndex := -1
+		furthestDistance := d.Tolerance
+		for index := first + 1; index < last; index++ {
+			distance := getDistanceToSegment(points[index], points[first], points[last])
+			if distance > furthestDistance {
+				furthestIndex = index
+				furthestDistance = distance
+			}
+		}
+
+		if furthestIndex >= 0 {
+			keep[furthestIndex] = true
+			rangeStack = append(rangeStack, [2]int{first, furthestIndex}, [2]int{furthestIndex, last})
+		}
+	}
+
+	newPoints := [][2]int{}
+	for index, nextPoint := range points {
+		if keep[index] {
+			newPoints = append(newPoints, nextPoint)
+		}
+	}
+	return newPoints
+}
+
+type deviationItem struct {
+	index     int
+	deviation float64
+	version   int
+}
+
+// A min-heap of points by how much dropping them would move the outline
+type deviationHeap []deviationItem
+
+func (h deviationHeap) Len() int               { return len(h) }
+func (h deviationHeap) Less(i, j int) bool     { return h[i].deviation < h[j].deviation }
+func (h deviationHeap) Swap(i, j int)          { h[i], h[j] = h[j], h[i] }
+func (h *deviationHeap) Push(item interface{}) { *h = append(*h, item.(deviationItem)) }
+func (h *deviationHeap) Pop() interface{} {
+	old := *h
+	item := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return item
+}
+
+func (v VisvalingamWhyatt) SimplifyPolyline(points [][2]int) [][2]int {
+	pointCount := len(points)
+	if pointCount < 3 {
+		return append([][2]int{}, points...)
+	}
+
+	// A linked list of the points that are left
+	prevIndexes := make([]int, pointCount)
+	nextIndexes := make([]int, pointCount)
+	versions := make([]int, pointCount)
+	removed := make([]bool, pointCount)
+	for index := range points {
+		prevIndexes[index] = index - 1
+		nextIndexes[index] = index + 1
+	}
+
+	getDeviation := func(index int) float64 {
+		return getDistanceToSegment(points[index], points[prevIndexes[index]], points[nextIndexes[index]])
+	}
+
+	deviations := &deviationHeap{}
+	for index := 1; index < pointCount-1; index++ {
+		*deviations = append(*deviations, deviationItem{index: index, deviation: getDeviation(index)})
+	}
+	heap.Init(deviations)
+
+	for deviations.Len() > 0 {
+		item := heap.Pop(deviations).(deviationItem)
+		if removed[item.index] || item.version != versions[item.index] {
+			continue // Out of date, since a neighbor was dropped
+		}
+		if item.deviation > v.Tolerance {
+			break
+		}
+
+		removed[item.index] = true
+		prevIndex := prevIndexes[item.index]
+		nextIndex := nextIndexes[item.index]
+		nextIndexes[prevIndex] = nextIndex
+		prevIndexes[nextIndex] = prevIndex
+
+		for _, neighborIndex := range []int{prevIndex, nextIndex} {
+			if neighborIndex == 0 || neighborIndex == pointCount-1 {
+				continue
+			}
+			versions[neighborIndex]++
+			heap.Push(deviations, deviationItem{
+				index:     neighborIndex,
+				deviation: getDeviation(neighborIndex),
+				version:   versions[neighborIndex],
+			})
+		}
+	}
+
+	newPoints := [][2]int{}
+	for index, nextPoint := range points {
+		if !removed[index] {
+			newPoints = append(newPoints, nextPoint)
+		}
+	}
+	return newPoints
+}
+
+/*
+ * Simplify the closed outline of a polygon. It is split into two polylines,
+ * at its first point and the point furthest from that, which are both kept.
+ *
+ * Returns the number of points removed and the new outline.
+ * If simplifying would leave fewer than 3 points, the outline is unchanged.
+ */
+func SimplifyPolygon(outlinePoints [][2]int, simplifier Simplifier) (int, [][2]int) {
+	if len(outlinePoints) < 4 {
+		return 0, outlinePoints
+	}
+
+	furthestIndex := 0
+	furthestDistance := -1.0
+	firstPoint := toFloatPoint(outlinePoints[0])
+	for index, nextPoint := range outlinePoints {
+		distance := getPointLength(subtractPoints(toFloatPoint(nextPoint), firstPoint))
+		if distance > furthestDistance {
+			furthestIndex = index
+			furthestDistance = distance
+		}
+	}
+
+	firstHalf := simplifier.SimplifyPolyline(outlinePoints[:furthestIndex+1])
+	secondHalf := simplifier.SimplifyPolyline(
+		append(append([][2]int{}, outlinePoints[furthestIndex:]...), outlinePoints[0]),
+	)
+
+	newPoints := append(firstHalf, secondHalf[1:len(secondHalf)-1]...)
+	if len(newPoints) < 3 {
+		return 0, outlinePoints
+	}
+	return len(outlinePoints) - len(newPoints), newPoints
+}
+
+/*
+ * Simplify an outline with the Simplifier, if there is one,
+ * and add the number of points it removes to PointsRemoved
+ */
+func (s *ShapeExtractor) simplifyOutline(outlinePoints [][2]int) [][2]int {
+	if s.Simplifier == nil {
+		return outlinePoints
+	}
+	removedCount, newPoints := SimplifyPolygon(outlinePoints, s.Simplifier)
+	s.PointsRemoved += removedCount
+	return newPoints
+}
@@ -0,0 +1,89 @@
+package pixels2svg
+
+import (
+	"testing"
+)
+
+/*
+ * A line with a small bump, which is within tolerance, and a big one
+ */
+func getBumpyLine() [][2]int {
+	return [][2]int{{0, 0}, {2, 0}, {3, 1}, {4, 0}, {6, 0}, {7, 5}, {8, 0}, {10, 0}}
+}
+
+func TestDouglasPeuckerSimplifyPolyline(t *testing.T) {
+	results := DouglasPeucker{Tolerance: 1.5}.SimplifyPolyline(getBumpyLine())
+	expected := [][2]int{{0, 0}, {6, 0}, {7, 5}, {8, 0}, {10, 0}}
+
+	err := compareOutlinePoints(results, expected)
+	if err != "" {
+		t.Errorf("Simplified line. %s", err)
+	}
+}
+
+func TestVisvalingamWhyattSimplifyPolyline(t *testing.T) {
+	results := VisvalingamWhyatt{Tolerance: 1.5}.SimplifyPolyline(getBumpyLine())
+	expected := [][2]int{{0, 0}, {6, 0}, {7, 5}, {8, 0}, {10, 0}}
+
+	err := compareOutlinePoints(results, expected)
+	if err != "" {
+		t.Errorf("Simplified line. %s", err)
+	}
+}
+
+func TestSimplifyPolygon(t *testing.T) {
+	outlinePoints := [][2]int{{0, 0}, {3, 0}, {6, 1}, {9, 0}, {9, 5}, {5, 5}, {0, 5}, {0, 2}}
+	expected := [][2]int{{0, 0}, {9, 0}, {9, 5}, {0, 5}}
+
+	for name, simplifier := range map[string]Simplifier{
+		"DouglasPeucker":    DouglasPeucker{Tolerance: 1},
+		"VisvalingamWhyatt": VisvalingamWhyatt{Tolerance: 1},
+	} {
+		removedCount, results := SimplifyPolygon(outlinePoints, simplifier)
+		if removedCount != 4 {
+			t.Errorf("%s. Expected 4 points removed, but got %d", name, removedCount)
+		}
+
+		err := compareOutlinePoints(results, expected)
+		if err != "" {
+			t.Errorf("%s. Simplified polygon. %s", name, err)
+		}
+	}
+}
+
+/*
+ * A staircase is a straight diagonal within a pixel
+ */
+func TestProcessAllRegionsSimplifier(t *testing.T) {
+	a := [4]uint8{1, 1, 1, 1}
+	b := [4]uint8{2, 2, 2, 2}
+
+	var s ShapeExtractor
+	s.Init([][][4]uint8{
+		{b, a, a, a},
+		{b, b, a, a},
+		{b, b, b, a},
+		{b, b, b, b},
+	})
+	s.Simplifier = DouglasPeucker{Tolerance: 1}
+
+	results := s.ProcessAllRegions()
+	expected := []Polygon{
+		{
+			ColorRGBA: b,
+			Points:    [][2]int{{0, 0}, {4, 0}, {4, 4}},
+		},
+		{
+			ColorRGBA: a,
+			Points:    [][2]int{{0, 1}, {3, 4}, {0, 4}},
+		},
+	}
+
+	err := comparePolygons(results, expected)
+	if err != "" {
+		t.Errorf("\nPolygons. %s", err)
+	}
+	if s.PointsRemoved != 12 {
+		t.Errorf("Expected 12 points removed, but got %d", s.PointsRemoved)
+	}
+}
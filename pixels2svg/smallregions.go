@@ -0,0 +1,103 @@
+package pixels2svg
+
+/*
+ * Small regions
+ *
+ * Noise and antialiasing leave specks of a few pixels, each of which would
+ * become a shape of its own. With MinRegionSize, regions with fewer cells
+ * are given the color of most of the cells around them first, so that they
+ * become part of a neighboring shape.
+ */
+
+/*
+ * Get the grid ready for finding shapes: merge the small regions into
+ * their neighbors (only the first time) and mark the transparent cells
+ * as already done.
+ */
+func (s *ShapeExtractor) prepareGrid() {
+	s.mergeSmallRegionsOnce()
+	s.markTransparentCellsDone()
+}
+
+func (s *ShapeExtractor) mergeSmallRegionsOnce() {
+	if !s.smallRegionsMerged {
+		s.smallRegionsMerged = true
+		s.mergeSmallRegions()
+	}
+}
+
+/*
+ * Give each region with fewer than MinRegionSize cells the color that most
+ * of the cells next to it have. The regions are changed one at a time,
+ * going right, then down. Only the extractor's own copy of the colors
+ * is changed, so the grid passed to Init stays as it is.
+ */
+func (s *ShapeExtractor) mergeSmallRegions() {
+	if s.MinRegionSize <= 1 {
+		return
+	}
+
+	s.setNeighborEvaluators()
+	smallRegions := [][][2]int{}
+	for rowIndex := 0; rowIndex < s.RowCount; rowIndex++ {
+		for colIndex := 0; colIndex < s.ColCount; colIndex++ {
+			if s.isDone(colIndex, rowIndex) {
+				continue
+			}
+			regionCells := s.getRegionCells(colIndex, rowIndex, s.getColor(colIndex, rowIndex))
+			if len(regionCells) < s.MinRegionSize {
+				smallRegions = append(smallRegions, append([][2]int{}, regionCells...))
+			}
+		}
+		if s.checkContext() != nil {
+			s.doneCells.clearAll()
+			return // The scan that follows stops with the error
+		}
+	}
+
+	s.doneCells.clearAll()
+
+	for _, regionCells := range smallRegions {
+		newColor, found := s.getSurroundingColor(regionCells)
+		if !found {
+			continue // The region is the whole grid
+		}
+		for _, nextCell := range regionCells {
+			s.setColor(nextCell[0], nextCell[1], newColor)
+		}
+	}
+}
+
+/*
+ * Get the color most of the cells next to a region (sharing a side with
+ * one of its cells) have. When there's a tie, the color found first wins.
+ * Returns false if there are no cells next to it.
+ */
+func (s *ShapeExtractor) getSurroundingColor(regionCells [][2]int) ([4]uint8, bool) {
+	isInRegion := map[[2]int]bool{}
+	for _, nextCell := range regionCells {
+		isInRegion[nextCell] = true
+	}
+
+	colorCounts := map[[4]uint8]int{}
+	var mostColor [4]uint8
+	mostCount := 0
+	for _, nextCell := range regionCells {
+		for _, offset := range edgeOffsets {
+			neighbor := [2]int{nextCell[0] + offset[0], nextCell[1] + offset[1]}
+			isOnGrid := neighbor[0] >= 0 && neighbor[1] >= 0 && neighbor[0] < s.ColCount && neighbor[1] < s.RowCount
+			if !isOnGrid || isInRegion[neighbor] {
+				continue
+			}
+
+			color := s.getColor(neighbor[0], neighbor[1])
+			colorCounts[color]++
+			if colorCounts[color] > mostCount {
+				mostColor = color
+				mostCount = colorCounts[color]
+			}
+		}
+	}
+
+	return mostColor, mostCount > 0
+}
@@ -0,0 +1,75 @@
+package pixels2svg
+
+import (
+	"bufio"
+	"fmt"
+)
+
+/*
+ * Style sheet
+ *
+ * With UseStyleSheet, each color gets a CSS class and a rule in a <style>
+ * element, and the shapes only carry their class. When tracing through the
+ * pixel centers, polygons need a stroke of their own color. Rectangles
+ * mustn't have one, so the stroke is set for polygons and paths only and
+ * takes the color of the class through currentColor.
+ */
+
+/*
+ * Get the class name for a color
+ */
+func DefaultClassName(index int, colorRGBA [4]uint8) string {
+	return fmt.Sprintf("c%d", index)
+}
+
+/*
+ * Get the class of the shapes of a color: its hex color, or with
+ * UseStyleSheet, the class of its rule in the style sheet
+ */
+func (s *ShapeExtractor) getClassName(colorRGBA [4]uint8) string {
+	if !s.UseStyleSheet {
+		return GetHexColor(colorRGBA)
+	}
+
+	className, found := s.classNames[colorRGBA]
+	if !found {
+		getName := s.ClassName
+		if getName == nil {
+			getName = DefaultClassName
+		}
+		className = getName(len(s.styleSheetColors), colorRGBA)
+		s.classNames[colorRGBA] = className
+		s.styleSheetColors = append(s.styleSheetColors, colorRGBA)
+	}
+	return className
+}
+
+/*
+ * Write the <style> element, with a rule for each color that has been
+ * given a class
+ */
+func (s *ShapeExtractor) writeSVGStyleSheet(svgWriter *bufio.Writer) error {
+	hasStroke := !s.hasCornerCoordinates()
+
+	svgWriter.WriteString(" <style>\n")
+	for _, nextColor := range s.styleSheetColors {
+		hexColor := GetHexColor(nextColor)
+		fmt.Fprintf(svgWriter, "  .%s{fill:%s", s.classNames[nextColor], hexColor)
+		if hasStroke {
+			fmt.Fprintf(svgWriter, ";color:%s", hexColor)
+		}
+		if s.UseAlpha && nextColor[3] != 255 {
+			opacity := GetOpacity(nextColor)
+			fmt.Fprintf(svgWriter, ";fill-opacity:%s", opacity)
+			if hasStroke {
+				fmt.Fprintf(svgWriter, ";stroke-opacity:%s", opacity)
+			}
+		}
+		svgWriter.WriteString("}\n")
+	}
+	if hasStroke {
+		svgWriter.WriteString("  polygon,path{stroke:currentColor}\n")
+	}
+	_, err := svgWriter.WriteString(" </style>\n")
+	return err
+}
@@ -0,0 +1,76 @@
+package pixels2svg
+
+import (
+	"fmt"
+	"testing"
+)
+
+/*
+ *    0  1  2
+ *  0 a  a  b
+ *  1 a  a  b
+ */
+func TestGetSVGTextStyleSheet(t *testing.T) {
+	a := [4]uint8{1, 1, 1, 255}
+	b := [4]uint8{2, 2, 2, 128}
+	colorGrid := [][][4]uint8{
+		{a, a}, // Column 0
+		{a, a}, // Column 1
+		{b, b}, // Column 2
+	}
+
+	var s ShapeExtractor
+	s.Init(colorGrid)
+	s.UseAlpha = true
+	s.UseStyleSheet = true
+
+	results := s.GetSVGText()
+	expected := `<svg xmlns="http://www.w3.org/2000/svg" width="3" height="2" viewBox="-0.5 -0.5 3 2">
+ <style>
+  .c0{fill:#010101;color:#010101}
+  .c1{fill:#020202;color:#020202;fill-opacity:0.502;stroke-opacity:0.502}
+  polygon,path{stroke:currentColor}
+ </style>
+ <g>
+  <polygon class="c0" points="0,0 1,0 1,1 0,1 " />
+  <rect class="c1" x="1.5" y="-0.5" width="1" height="2" />
+ </g>
+</svg>`
+
+	if results != expected {
+		t.Errorf("Expected svg\n%s\nbut got\n%s", expected, results)
+	}
+}
+
+func TestGetSVGTextStyleSheetClassName(t *testing.T) {
+	a := [4]uint8{1, 1, 1, 255}
+	b := [4]uint8{2, 2, 2, 255}
+	colorGrid := [][][4]uint8{
+		{a, a}, // Column 0
+		{b, a}, // Column 1
+	}
+
+	var s ShapeExtractor
+	s.Init(colorGrid)
+	s.TraceEdges = true
+	s.UseStyleSheet = true
+	s.ClassName = func(index int, colorRGBA [4]uint8) string {
+		return fmt.Sprintf("shade-%d", colorRGBA[0])
+	}
+
+	results := s.GetSVGText()
+	expected := `<svg xmlns="http://www.w3.org/2000/svg" width="2" height="2" viewBox="0 0 2 2">
+ <style>
+  .shade-1{fill:#010101}
+  .shade-2{fill:#020202}
+ </style>
+ <g>
+  <polygon class="shade-1" points="0,0 1,0 1,1 2,1 2,2 0,2 " />
+  <polygon class="shade-2" points="1,0 2,0 2,1 1,1 " />
+ </g>
+</svg>`
+
+	if results != expected {
+		t.Errorf("Expected svg\n%s\nbut got\n%s", expected, results)
+	}
+}
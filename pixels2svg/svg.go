@@ -0,0 +1,458 @@
+package pixels2svg
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+)
+
+/*
+ * Write the svg xml for all the shapes to w. Each shape is written as soon
+ * as it's found, rather than building the whole document in memory first.
+ *
+ * The writes go through a bufio.Writer, which keeps the first error it gets
+ * and returns it for every write after that. So it's enough to check the
+ * error of the last write for each shape.
+ *
+ * Returns a *LimitError if one of the limits in the Config is hit.
+ *
+ * With MergeByColor, the shapes are collected first and then written
+ * as one path per color. With UseStyleSheet, the shapes are all written
+ * to memory first, since the style sheet comes before them.
+ */
+func (s *ShapeExtractor) WriteSVG(w io.Writer) error {
+	return s.WriteSVGContext(context.Background(), w)
+}
+
+/*
+ * Same as WriteSVG, but stops with the context's error as soon as
+ * it's done
+ */
+func (s *ShapeExtractor) WriteSVGContext(ctx context.Context, w io.Writer) error {
+	return s.writeSVGDocument(ctx, w, s.processAllShapes)
+}
+
+/*
+ * Write the svg xml for shapes that have already been found, e.g. by
+ * GetAllShapes and then recolored, using the same options as WriteSVG.
+ */
+func (s *ShapeExtractor) WriteShapesSVG(w io.Writer, allPolygons []Polygon, allLines []Line) error {
+	return s.writeSVGDocument(
+		context.Background(),
+		w,
+		func(emitPolygon func(Polygon) error, emitLine func(Line) error, emitRectangle func(Rectangle) error) error {
+			for _, nextPolygon := range allPolygons {
+				if err := emitPolygon(nextPolygon); err != nil {
+					return err
+				}
+			}
+			for _, nextLine := range allLines {
+				if err := emitLine(nextLine); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	)
+}
+
+func (s *ShapeExtractor) GetShapesSVGText(allPolygons []Polygon, allLines []Line) string {
+	var svgBuffer bytes.Buffer
+	s.WriteShapesSVG(&svgBuffer, allPolygons, allLines)
+
+	return svgBuffer.String()
+}
+
+/*
+ * Passes each shape to the emit function for its kind, like processAllShapes
+ */
+type shapeProcessor func(
+	emitPolygon func(Polygon) error,
+	emitLine func(Line) error,
+	emitRectangle func(Rectangle) error,
+) error
+
+/*
+ * Write the svg xml for the shapes processShapes passes on, stopping
+ * when the context is done or one of the limits is hit
+ */
+func (s *ShapeExtractor) writeSVGDocument(ctx context.Context, w io.Writer, processShapes shapeProcessor) error {
+	if s.initErr != nil {
+		return s.initErr
+	}
+	processShapes = s.limitShapes(ctx, processShapes)
+	svgWriter := bufio.NewWriter(w)
+	s.styleSheetColors = nil
+	s.classNames = map[[4]uint8]string{}
+
+	if err := s.writeSVGHeader(svgWriter); err != nil {
+		return err
+	}
+
+	if s.UseStyleSheet {
+		// The style sheet needs every color, so the shapes have to be found first
+		var shapesBuffer bytes.Buffer
+		shapesWriter := bufio.NewWriter(&shapesBuffer)
+		if err := s.writeSVGShapes(shapesWriter, processShapes); err != nil {
+			return err
+		}
+		shapesWriter.Flush() // Writing to a Buffer doesn't return errors
+
+		s.setPhase(PhaseRendering)
+		s.writeSVGStyleSheet(svgWriter)
+		svgWriter.WriteString(" <g>\n")
+		svgWriter.Write(shapesBuffer.Bytes())
+	} else {
+		svgWriter.WriteString(" <g>\n")
+		if err := s.writeSVGShapes(svgWriter, processShapes); err != nil {
+			return err
+		}
+	}
+
+	s.setPhase(PhaseRendering)
+	if _, err := svgWriter.WriteString(" </g>\n</svg>"); err != nil {
+		return err
+	}
+	return svgWriter.Flush()
+}
+
+/*
+ * Write the elements for all the shapes
+ */
+func (s *ShapeExtractor) writeSVGShapes(svgWriter *bufio.Writer, processShapes shapeProcessor) error {
+	if s.MergeByColor {
+		return s.writeMergedShapes(svgWriter, processShapes)
+	}
+
+	return processShapes(
+		func(nextPolygon Polygon) error {
+			return s.writeSVGPolygon(svgWriter, nextPolygon)
+		},
+		func(nextLine Line) error {
+			return s.writeSVGLine(svgWriter, nextLine)
+		},
+		func(nextRectangle Rectangle) error {
+			return s.writeSVGRectangle(svgWriter, nextRectangle)
+		},
+	)
+}
+
+/*
+ * Get the width and height of the svg element. By default, one unit per
+ * pixel, unless OutputWidth, OutputHeight or Scale are set.
+ * If only one of OutputWidth and OutputHeight is set, the other one keeps
+ * the proportions of the grid.
+ */
+func (s *ShapeExtractor) getOutputSize() (float64, float64) {
+	colCount := float64(s.ColCount)
+	rowCount := float64(s.RowCount)
+
+	switch {
+	case s.OutputWidth > 0 && s.OutputHeight > 0:
+		return s.OutputWidth, s.OutputHeight
+	case s.OutputWidth > 0 && colCount > 0:
+		return s.OutputWidth, s.OutputWidth * rowCount / colCount
+	case s.OutputHeight > 0 && rowCount > 0:
+		return s.OutputHeight * colCount / rowCount, s.OutputHeight
+	case s.Scale > 0:
+		return colCount * s.Scale, rowCount * s.Scale
+	}
+	return colCount, rowCount
+}
+
+/*
+ * Write the opening of the svg element.
+ *
+ * The viewBox is the size of the grid. When tracing through the pixel
+ * centers, the coordinates of a pixel are those of its center, so the
+ * viewBox starts half a pixel up and to the left of the first pixel.
+ */
+func (s *ShapeExtractor) writeSVGHeader(svgWriter *bufio.Writer) error {
+	if s.XMLDeclaration {
+		svgWriter.WriteString("<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n")
+	}
+
+	viewBoxStart := "-0.5 -0.5"
+	if s.hasCornerCoordinates() {
+		viewBoxStart = "0 0"
+	}
+	width, height := s.getOutputSize()
+
+	fmt.Fprintf(
+		svgWriter,
+		`<svg xmlns="http://www.w3.org/2000/svg" width="%s" height="%s" viewBox="%s %d %d"`,
+		formatNumber(width),
+		formatNumber(height),
+		viewBoxStart,
+		s.ColCount,
+		s.RowCount,
+	)
+	if s.CrispEdges {
+		svgWriter.WriteString(` shape-rendering="crispEdges"`)
+	}
+	_, err := svgWriter.WriteString(">\n")
+	return err
+}
+
+/*
+ * Format a number for the svg with no more than three decimals
+ * and no trailing zeros, e.g. 2, 0.5 or 1.333
+ */
+func formatNumber(number float64) string {
+	return strconv.FormatFloat(math.Round(number*1000)/1000, 'f', -1, 64)
+}
+
+func (s *ShapeExtractor) GetSVGText() string {
+	var svgBuffer bytes.Buffer // Concatenation is more economical with a Buffer
+	s.WriteSVG(&svgBuffer)     // Writing to a Buffer doesn't return errors
+
+	return svgBuffer.String()
+}
+
+func (s *ShapeExtractor) WriteSVGToFile(filePath string) error {
+	f, err := os.Create(filePath)
+	if err != nil {
+		return err
+	}
+
+	err = s.WriteSVG(f)
+	closeErr := f.Close()
+	if err != nil {
+		return err
+	}
+	return closeErr
+}
+
+func (s *ShapeExtractor) writeSVGPolygon(svgWriter *bufio.Writer, polygon Polygon) error {
+	className := s.getClassName(polygon.ColorRGBA)
+	// Polygons along the pixel edges already cover whole pixels,
+	// so a stroke would overlap neighbors
+	paint := s.getPaintAttributes(polygon.ColorRGBA, !s.hasCornerCoordinates())
+	if s.Smooth {
+		return s.writeSVGCurvePath(svgWriter, polygon, className, paint)
+	}
+	if len(polygon.Holes) > 0 {
+		return writeSVGPath(svgWriter, polygon, className, paint)
+	}
+
+	fmt.Fprintf(svgWriter, `  <polygon class="%s" points="`, className)
+	for _, nextPoint := range polygon.Points {
+		fmt.Fprintf(svgWriter, "%d,%d ", nextPoint[0], nextPoint[1])
+	}
+
+	_, err := fmt.Fprintf(svgWriter, "\"%s />\n", paint)
+	return err
+}
+
+/*
+ * Get the rectangles that cover a line of cells exactly. A horizontal or
+ * vertical line is one rectangle and a diagonal line is one rectangle
+ * per cell.
+ */
+func getLineRectangles(line Line) []Rectangle {
+	colStep := getStep(line.ColX1, line.ColX2)
+	rowStep := getStep(line.RowY1, line.RowY2)
+	rectangle := Rectangle{
+		ColorRGBA: line.ColorRGBA,
+		ColX:      line.ColX1,
+		RowY:      line.RowY1,
+		Width:     1,
+		Height:    1,
+	}
+	cellCount := 1
+
+	switch {
+	case colStep != 0 && rowStep != 0: // Diagonal
+		cellCount += (line.ColX2 - line.ColX1) * colStep
+	case colStep != 0: // Horizontal
+		rectangle.Width += (line.ColX2 - line.ColX1) * colStep
+		if colStep < 0 {
+			rectangle.ColX = line.ColX2
+		}
+	case rowStep != 0: // Vertical
+		rectangle.Height += (line.RowY2 - line.RowY1) * rowStep
+		if rowStep < 0 {
+			rectangle.RowY = line.RowY2
+		}
+	}
+
+	allRectangles := make([]Rectangle, cellCount)
+	for index := range allRectangles {
+		allRectangles[index] = rectangle
+		rectangle.ColX += colStep
+		rectangle.RowY += rowStep
+	}
+	return allRectangles
+}
+
+/*
+ * Write a line of cells as rectangles that cover the cells exactly,
+ * so that even a single cell shows up.
+ */
+func (s *ShapeExtractor) writeSVGLine(svgWriter *bufio.Writer, line Line) error {
+	var err error
+	for _, nextRectangle := range getLineRectangles(line) {
+		err = s.writeSVGRectangle(svgWriter, nextRectangle)
+	}
+	return err
+}
+
+/*
+ * Write a rectangle of cells. When the coordinates are those of the cell
+ * centers, each cell starts half a unit up and to the left of them.
+ */
+func (s *ShapeExtractor) writeSVGRectangle(svgWriter *bufio.Writer, rectangle Rectangle) error {
+	offset := -0.5
+	if s.hasCornerCoordinates() {
+		offset = 0
+	}
+
+	_, err := fmt.Fprintf(
+		svgWriter,
+		"  <rect class=\"%s\" x=\"%s\" y=\"%s\" width=\"%d\" height=\"%d\"%s />\n",
+		s.getClassName(rectangle.ColorRGBA),
+		formatNumber(float64(rectangle.ColX)+offset),
+		formatNumber(float64(rectangle.RowY)+offset),
+		rectangle.Width,
+		rectangle.Height,
+		s.getPaintAttributes(rectangle.ColorRGBA, false),
+	)
+	return err
+}
+
+// -1, 0 or 1, to go from one coordinate towards another
+func getStep(from, to int) int {
+	switch {
+	case to > from:
+		return 1
+	case to < from:
+		return -1
+	}
+	return 0
+}
+
+/*
+ * Write a polygon that has holes as a single path, with a subpath for its
+ * outline and one for each hole. The even-odd fill rule leaves the holes empty.
+ */
+func writeSVGPath(svgWriter *bufio.Writer, polygon Polygon, className, paint string) error {
+	fmt.Fprintf(svgWriter, `  <path class="%s" d="`, className)
+
+	allOutlines := append([][][2]int{polygon.Points}, polygon.Holes...)
+	for _, nextOutline := range allOutlines {
+		for index, nextPoint := range nextOutline {
+			if index == 0 {
+				svgWriter.WriteString("M")
+			} else {
+				svgWriter.WriteString("L")
+			}
+			fmt.Fprintf(svgWriter, "%d,%d ", nextPoint[0], nextPoint[1])
+		}
+		svgWriter.WriteString("Z ")
+	}
+	_, err := fmt.Fprintf(svgWriter, "\" fill-rule=\"evenodd\"%s />\n", paint)
+	return err
+}
+
+/*
+ * Get the curves for an outline, using the default tolerance and
+ * corner angle unless they are set
+ */
+func (s *ShapeExtractor) getOutlineCurves(outlinePoints [][2]int) []BezierSegment {
+	tolerance := s.SmoothTolerance
+	if tolerance <= 0 {
+		tolerance = DefaultSmoothTolerance
+	}
+	cornerAngle := s.CornerAngle
+	if cornerAngle <= 0 {
+		cornerAngle = DefaultCornerAngle
+	}
+	return FitOutlineCurves(outlinePoints, tolerance, cornerAngle)
+}
+
+/*
+ * Write a polygon as a single path of cubic Bezier curves, with a subpath
+ * for its outline and one for each hole.
+ */
+func (s *ShapeExtractor) writeSVGCurvePath(
+	svgWriter *bufio.Writer,
+	polygon Polygon,
+	className, paint string,
+) error {
+	fmt.Fprintf(svgWriter, `  <path class="%s" d="`, className)
+
+	allOutlines := append([][][2]int{polygon.Points}, polygon.Holes...)
+	for _, nextOutline := range allOutlines {
+		allCurves := s.getOutlineCurves(nextOutline)
+		if len(allCurves) == 0 {
+			continue
+		}
+		start := allCurves[0].Start
+		fmt.Fprintf(svgWriter, "M%s,%s ", formatNumber(start[0]), formatNumber(start[1]))
+		for _, nextCurve := range allCurves {
+			fmt.Fprintf(
+				svgWriter,
+				"C%s,%s %s,%s %s,%s ",
+				formatNumber(nextCurve.Control1[0]),
+				formatNumber(nextCurve.Control1[1]),
+				formatNumber(nextCurve.Control2[0]),
+				formatNumber(nextCurve.Control2[1]),
+				formatNumber(nextCurve.End[0]),
+				formatNumber(nextCurve.End[1]),
+			)
+		}
+		svgWriter.WriteString("Z ")
+	}
+
+	_, err := fmt.Fprintf(svgWriter, "\" fill-rule=\"evenodd\"%s />\n", paint)
+	return err
+}
+
+/*
+ * Get the attributes that paint a shape in a color: its fill, its stroke
+ * (if it has one) and their opacity. With UseStyleSheet, the style sheet
+ * paints the shapes instead, so there aren't any.
+ */
+func (s *ShapeExtractor) getPaintAttributes(colorRGBA [4]uint8, hasStroke bool) string {
+	if s.UseStyleSheet {
+		return ""
+	}
+	hexColor := GetHexColor(colorRGBA)
+	opacity := s.getOpacityAttributes(colorRGBA, hasStroke)
+	if hasStroke {
+		return fmt.Sprintf(` stroke="%s" fill="%s"%s`, hexColor, hexColor, opacity)
+	}
+	return fmt.Sprintf(` fill="%s"%s`, hexColor, opacity)
+}
+
+/*
+ * If alpha values are being used and the color is partially transparent,
+ * get the opacity attributes for it. Otherwise, an empty string.
+ */
+func (s *ShapeExtractor) getOpacityAttributes(colorRGBA [4]uint8, hasStroke bool) string {
+	if !s.UseAlpha || colorRGBA[3] == 255 {
+		return ""
+	}
+	opacity := GetOpacity(colorRGBA)
+	if hasStroke {
+		return fmt.Sprintf(` stroke-opacity="%s" fill-opacity="%s"`, opacity, opacity)
+	}
+	return fmt.Sprintf(` fill-opacity="%s"`, opacity)
+}
+
+/*
+ * Get the alpha value of a color as an opacity between 0 and 1,
+ * rounded to three decimals, e.g. "0.502"
+ */
+func GetOpacity(colorRGBA [4]uint8) string {
+	return formatNumber(float64(colorRGBA[3]) / 255)
+}
+
+func GetHexColor(colorRGBA [4]uint8) string {
+	return fmt.Sprintf("#%02X%02X%02X", colorRGBA[0], colorRGBA[1], colorRGBA[2])
+}
@@ -0,0 +1,155 @@
+package pixels2svg
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+type failingWriter struct {
+	writesLeft int
+}
+
+func (w *failingWriter) Write(p []byte) (int, error) {
+	if w.writesLeft <= 0 {
+		return 0, errors.New("disk full")
+	}
+	w.writesLeft--
+	return len(p), nil
+}
+
+func TestWriteSVG(t *testing.T) {
+	var s ShapeExtractor
+	s.Init(getBigColorGrid())
+
+	var svgBuffer bytes.Buffer
+	err := s.WriteSVG(&svgBuffer)
+	if err != nil {
+		t.Errorf("Unexpected error: %s", err)
+		return
+	}
+
+	s.Init(getBigColorGrid())
+	expected := s.GetSVGText()
+	results := svgBuffer.String()
+
+	if results != expected {
+		t.Errorf("\nExpected \n%s, \nbut got \n%s", expected, results)
+	}
+}
+
+func TestWriteSVGWriterError(t *testing.T) {
+	var s ShapeExtractor
+
+	// Big enough that the bufio.Writer has to write more than once
+	colorGrid := [][][4]uint8{}
+	for colX := 0; colX < 100; colX++ {
+		nextCol := [][4]uint8{}
+		for rowY := 0; rowY < 100; rowY++ {
+			nextCol = append(nextCol, [4]uint8{uint8(colX), uint8(rowY), 0, 0})
+		}
+		colorGrid = append(colorGrid, nextCol)
+	}
+	s.Init(colorGrid)
+
+	err := s.WriteSVG(&failingWriter{writesLeft: 1})
+	if err == nil || err.Error() != "disk full" {
+		t.Errorf("Expected the writer's error, but got %v", err)
+	}
+}
+
+func TestWriteSVGToFileBadPath(t *testing.T) {
+	var s ShapeExtractor
+	s.Init(getColorGrid())
+
+	filePath := filepath.Join(t.TempDir(), "missing", "output.svg")
+	err := s.WriteSVGToFile(filePath)
+	if err == nil {
+		t.Errorf("Expected an error for a missing folder")
+	}
+}
+
+func getSVGHeader(s *ShapeExtractor) string {
+	svgText := s.GetSVGText()
+	return svgText[:strings.Index(svgText, "\n")]
+}
+
+func TestGetSVGTextHeaderScaled(t *testing.T) {
+	var s ShapeExtractor
+	s.Init(getColorGrid())
+	s.Scale = 2.5
+	s.CrispEdges = true
+
+	results := getSVGHeader(&s)
+	expected := `<svg xmlns="http://www.w3.org/2000/svg" width="12.5" height="10"` +
+		` viewBox="-0.5 -0.5 5 4" shape-rendering="crispEdges">`
+
+	if results != expected {
+		t.Errorf("\nExpected \n%s, \nbut got \n%s", expected, results)
+	}
+}
+
+func TestGetSVGTextHeaderOutputWidth(t *testing.T) {
+	var s ShapeExtractor
+	s.Init(getColorGrid())
+	s.TraceEdges = true
+	s.OutputWidth = 100
+	s.Scale = 2.5 // Ignored, since OutputWidth is set
+
+	results := getSVGHeader(&s)
+	expected := `<svg xmlns="http://www.w3.org/2000/svg" width="100" height="80" viewBox="0 0 5 4">`
+
+	if results != expected {
+		t.Errorf("\nExpected \n%s, \nbut got \n%s", expected, results)
+	}
+}
+
+func TestGetSVGTextHeaderXMLDeclaration(t *testing.T) {
+	var s ShapeExtractor
+	s.Init(getColorGrid())
+	s.XMLDeclaration = true
+	s.OutputWidth = 30
+	s.OutputHeight = 40
+
+	results := getSVGHeader(&s)
+	expected := `<?xml version="1.0" encoding="UTF-8"?>`
+
+	if results != expected {
+		t.Errorf("\nExpected \n%s, \nbut got \n%s", expected, results)
+	}
+
+	expected = `<svg xmlns="http://www.w3.org/2000/svg" width="30" height="40" viewBox="-0.5 -0.5 5 4">`
+	if !strings.Contains(s.GetSVGText(), expected) {
+		t.Errorf("\nExpected svg element \n%s", expected)
+	}
+}
+
+func TestWriteSVGLineRects(t *testing.T) {
+	color := [4]uint8{1, 2, 3, 255}
+	allLines := []Line{
+		{ColorRGBA: color, ColX1: 4, RowY1: 1, ColX2: 2, RowY2: 1}, // Horizontal, going West
+		{ColorRGBA: color, ColX1: 3, RowY1: 1, ColX2: 1, RowY2: 3}, // Diagonal, going Southwest
+	}
+
+	var svgBuffer bytes.Buffer
+	svgWriter := bufio.NewWriter(&svgBuffer)
+	var s ShapeExtractor
+	for _, nextLine := range allLines {
+		s.writeSVGLine(svgWriter, nextLine)
+	}
+	svgWriter.Flush()
+
+	results := svgBuffer.String()
+	expected := `  <rect class="#010203" x="1.5" y="0.5" width="3" height="1" fill="#010203" />
+  <rect class="#010203" x="2.5" y="0.5" width="1" height="1" fill="#010203" />
+  <rect class="#010203" x="1.5" y="1.5" width="1" height="1" fill="#010203" />
+  <rect class="#010203" x="0.5" y="2.5" width="1" height="1" fill="#010203" />
+`
+
+	if results != expected {
+		t.Errorf("\nExpected \n%s, \nbut got \n%s", expected, results)
+	}
+}